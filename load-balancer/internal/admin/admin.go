@@ -0,0 +1,166 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/lokeshllkumar/load-balancer/internal/app"
+	"github.com/lokeshllkumar/load-balancer/internal/balancer"
+)
+
+// the runtime currently serving traffic, which changes on every config reload
+type RuntimeProvider interface {
+	Current() *app.Runtime
+}
+
+// JSON API for inspecting and controlling backends; served on its own listener
+type Handler struct {
+	provider RuntimeProvider
+	mux      *http.ServeMux
+}
+
+type backendView struct {
+	Service string `json:"service"`
+	balancer.BackendStatus
+}
+
+type strategyView struct {
+	Service  string `json:"service"`
+	Strategy string `json:"strategy"`
+	State    any    `json:"state,omitempty"`
+}
+
+func NewHandler(provider RuntimeProvider) *Handler {
+	h := &Handler{
+		provider: provider,
+		mux:      http.NewServeMux(),
+	}
+	h.mux.HandleFunc("GET /api/v1/backends", h.listBackends)
+	h.mux.HandleFunc("GET /api/v1/backends/{id}", h.getBackend)
+	h.mux.HandleFunc("POST /api/v1/backends/{id}/drain", h.backendAction("drain", (*balancer.BackendManager).Drain))
+	h.mux.HandleFunc("POST /api/v1/backends/{id}/disable", h.backendAction("disable", (*balancer.BackendManager).Disable))
+	h.mux.HandleFunc("POST /api/v1/backends/{id}/enable", h.backendAction("enable", (*balancer.BackendManager).Enable))
+	h.mux.HandleFunc("POST /api/v1/discover", h.serviceAction("discovery", (*balancer.BackendManager).Discover))
+	h.mux.HandleFunc("POST /api/v1/healthcheck", h.serviceAction("health check", (*balancer.BackendManager).CheckHealth))
+	h.mux.HandleFunc("GET /api/v1/strategies", h.listStrategies)
+	return h
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+// services named by the optional ?service= query parameter, all of them otherwise
+func (h *Handler) services(r *http.Request) []*app.Service {
+	services := h.provider.Current().Services()
+	name, filtered := r.URL.Query()["service"]
+	if !filtered {
+		return services
+	}
+
+	matching := make([]*app.Service, 0, 1)
+	for _, service := range services {
+		if service.Name == name[0] {
+			matching = append(matching, service)
+		}
+	}
+	return matching
+}
+
+func (h *Handler) listBackends(w http.ResponseWriter, r *http.Request) {
+	views := make([]backendView, 0)
+	for _, service := range h.services(r) {
+		for _, b := range service.Backends.Backends() {
+			views = append(views, backendView{Service: service.Name, BackendStatus: b.Status()})
+		}
+	}
+	writeJSON(w, http.StatusOK, views)
+}
+
+// an instance may belong to more than one service, so every match is returned
+func (h *Handler) getBackend(w http.ResponseWriter, r *http.Request) {
+	instanceID := r.PathValue("id")
+	views := make([]backendView, 0, 1)
+	for _, service := range h.services(r) {
+		if b := service.Backends.FindBackend(instanceID); b != nil {
+			views = append(views, backendView{Service: service.Name, BackendStatus: b.Status()})
+		}
+	}
+	if len(views) == 0 {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("backend %q not found", instanceID))
+		return
+	}
+	writeJSON(w, http.StatusOK, views)
+}
+
+// applies the action in every service knowing the instance and returns the resulting backends,
+// which may be empty once a drained backend has been removed
+func (h *Handler) backendAction(name string, action func(*balancer.BackendManager, string) bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		instanceID := r.PathValue("id")
+		found := false
+		views := make([]backendView, 0, 1)
+		for _, service := range h.services(r) {
+			if !action(service.Backends, instanceID) {
+				continue
+			}
+			found = true
+			if b := service.Backends.FindBackend(instanceID); b != nil {
+				views = append(views, backendView{Service: service.Name, BackendStatus: b.Status()})
+			}
+		}
+		if !found {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("backend %q not found", instanceID))
+			return
+		}
+		log.Printf("Admin: %s applied to backend %s", name, instanceID)
+		writeJSON(w, http.StatusOK, views)
+	}
+}
+
+// runs synchronously so the response reflects the outcome
+func (h *Handler) serviceAction(name string, action func(*balancer.BackendManager)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		services := h.services(r)
+		if len(services) == 0 {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("service %q not found", r.URL.Query().Get("service")))
+			return
+		}
+
+		views := make([]backendView, 0)
+		for _, service := range services {
+			log.Printf("Admin: forcing %s for service %q", name, service.Name)
+			action(service.Backends)
+			for _, b := range service.Backends.Backends() {
+				views = append(views, backendView{Service: service.Name, BackendStatus: b.Status()})
+			}
+		}
+		writeJSON(w, http.StatusOK, views)
+	}
+}
+
+func (h *Handler) listStrategies(w http.ResponseWriter, r *http.Request) {
+	views := make([]strategyView, 0)
+	for _, service := range h.services(r) {
+		view := strategyView{Service: service.Name, Strategy: service.StrategyName}
+		if reporter, ok := service.Strategy.(balancer.StateReporter); ok {
+			view.State = reporter.State()
+		}
+		views = append(views, view)
+	}
+	writeJSON(w, http.StatusOK, views)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Admin: failed to encode response: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
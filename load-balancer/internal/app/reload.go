@@ -0,0 +1,162 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lokeshllkumar/load-balancer/internal/config"
+	"github.com/lokeshllkumar/load-balancer/internal/sessionstore"
+)
+
+const (
+	// how long a replaced runtime is given to finish its in-flight requests before it is stopped
+	drainTimeout = 30 * time.Second
+	drainPoll    = 100 * time.Millisecond
+)
+
+// serves every request with the current runtime and swaps in a new one when the config is reloaded;
+// requests that started on the old runtime finish on it
+type Reloader struct {
+	configPath string
+	current    atomic.Pointer[Runtime]
+	mu         sync.Mutex // serializes reloads
+	modTime    time.Time
+	store      sessionstore.Store // kept across reloads
+}
+
+func NewReloader(configPath string, cfg *config.Config, store sessionstore.Store) (*Reloader, error) {
+	rl := &Reloader{
+		configPath: configPath,
+		store:      store,
+	}
+	if info, err := os.Stat(configPath); err == nil {
+		rl.modTime = info.ModTime()
+	}
+
+	rt, err := NewRuntime(cfg, store, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := rt.Start(); err != nil {
+		log.Printf("Starting without backends, discovery keeps retrying: %v", err)
+	}
+	rl.current.Store(rt)
+	return rl, nil
+}
+
+func (rl *Reloader) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rl.current.Load().ServeHTTP(w, r)
+}
+
+func (rl *Reloader) Current() *Runtime {
+	return rl.current.Load()
+}
+
+// re-reads and validates the config file, then atomically replaces the running configuration;
+// on any error the running configuration is left untouched
+func (rl *Reloader) Reload() error {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	if info, err := os.Stat(rl.configPath); err == nil {
+		rl.modTime = info.ModTime()
+	}
+
+	cfg, err := config.LoadConfig(rl.configPath)
+	if err != nil {
+		return fmt.Errorf("rejected new configuration: %w", err)
+	}
+
+	old := rl.current.Load()
+	if cfg.Port != old.Config().Port {
+		log.Printf("Port change from %d to %d requires a restart, keeping the current listener", old.Config().Port, cfg.Port)
+	}
+	if cfg.Admin != old.Config().Admin {
+		log.Printf("Admin listener changes require a restart, keeping the current one")
+	}
+	if !reflect.DeepEqual(cfg.TLS, old.Config().TLS) {
+		log.Printf("HTTPS listener changes require a restart, keeping the current one (certificate files are still reloaded)")
+	}
+	if !reflect.DeepEqual(cfg.TCPListeners, old.Config().TCPListeners) {
+		log.Printf("TCP listener changes require a restart, keeping the current ones")
+	}
+	if !reflect.DeepEqual(cfg.UDPListeners, old.Config().UDPListeners) {
+		log.Printf("UDP listener changes require a restart, keeping the current ones")
+	}
+	if !reflect.DeepEqual(cfg.ProxyProtocol, old.Config().ProxyProtocol) {
+		log.Printf("PROXY protocol changes require a restart, keeping the current trusted sources")
+	}
+	if !reflect.DeepEqual(cfg.SessionStore, old.Config().SessionStore) {
+		log.Printf("Session store changes require a restart, keeping the current store")
+	}
+
+	rt, err := NewRuntime(cfg, rl.store, old)
+	if err != nil {
+		return fmt.Errorf("rejected new configuration: %w", err)
+	}
+	// a runtime that could not reach the registry has no backends to serve with
+	if err := rt.Start(); err != nil {
+		rt.Stop()
+		return fmt.Errorf("rejected new configuration: %w", err)
+	}
+	rt.takeOver(old)
+	rt.inheritAdminState(old)
+
+	rl.current.Store(rt)
+	log.Printf("Configuration reloaded from %s with %d service(s) and %d route(s)", rl.configPath, len(cfg.Services), len(cfg.Routes))
+
+	go drainAndStop(old)
+	return nil
+}
+
+func drainAndStop(rt *Runtime) {
+	deadline := time.Now().Add(drainTimeout)
+	for rt.InFlight() > 0 && time.Now().Before(deadline) {
+		time.Sleep(drainPoll)
+	}
+	if remaining := rt.InFlight(); remaining > 0 {
+		log.Printf("Stopping previous configuration with %d request(s) still in flight", remaining)
+	}
+	rt.Stop()
+}
+
+// reloads whenever the config file's modification time changes
+func (rl *Reloader) WatchConfigFile(ctx context.Context, interval time.Duration) {
+	log.Printf("Watching %s for changes every %v", rl.configPath, interval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			info, err := os.Stat(rl.configPath)
+			if err != nil {
+				log.Printf("Failed to stat config file %s: %v", rl.configPath, err)
+				continue
+			}
+			rl.mu.Lock()
+			changed := !info.ModTime().Equal(rl.modTime)
+			rl.mu.Unlock()
+			if !changed {
+				continue
+			}
+
+			log.Printf("Config file %s changed, reloading", rl.configPath)
+			if err := rl.Reload(); err != nil {
+				log.Printf("Config reload failed: %v", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (rl *Reloader) Stop() {
+	rl.current.Load().Stop()
+}
@@ -0,0 +1,464 @@
+package app
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sync/atomic"
+	"time"
+
+	"github.com/lokeshllkumar/load-balancer/internal/balancer"
+	"github.com/lokeshllkumar/load-balancer/internal/config"
+	"github.com/lokeshllkumar/load-balancer/internal/forwarded"
+	"github.com/lokeshllkumar/load-balancer/internal/healthcheck"
+	"github.com/lokeshllkumar/load-balancer/internal/netutil"
+	"github.com/lokeshllkumar/load-balancer/internal/proxy"
+	"github.com/lokeshllkumar/load-balancer/internal/ratelimit"
+	"github.com/lokeshllkumar/load-balancer/internal/registry"
+	"github.com/lokeshllkumar/load-balancer/internal/router"
+	"github.com/lokeshllkumar/load-balancer/internal/sessionstore"
+	"github.com/lokeshllkumar/load-balancer/internal/tlsutil"
+)
+
+// everything built from a single config: the registry client, one backend pool,
+// strategy and proxy per service, and the router in front of them
+type Runtime struct {
+	cfg            *config.Config
+	handler        http.Handler
+	registryClient registry.ServiceRegistryClient
+	ownsRegistry   bool // false while the client is still the previous runtime's
+	services       []*Service
+	inFlight       atomic.Int64
+}
+
+// a configured pool and the strategy picking from it
+type Service struct {
+	Name         string
+	StrategyName string
+	Backends     *balancer.BackendManager
+	Strategy     balancer.LoadBalancingStrategy
+
+	config config.ServiceConfig
+	owned  bool               // false while the pool is still the previous runtime's
+	cancel context.CancelFunc // stops the pool's background work, nil until started
+}
+
+// builds every component without starting any background work, so a failed build leaves nothing behind;
+// the session store outlives runtimes so affinity survives reloads, nil keeps sticky sessions in cookies.
+// Services whose config is unchanged from the previous runtime keep its pool and strategy, and with them
+// their breaker, outlier, latency and connection state; nil builds everything anew
+func NewRuntime(cfg *config.Config, store sessionstore.Store, previous *Runtime) (*Runtime, error) {
+	rt := &Runtime{
+		cfg:      cfg,
+		services: make([]*Service, 0, len(cfg.Services)),
+	}
+
+	// pools hold on to the registry client, so they can only be kept along with it
+	previousServices := make(map[string]*Service)
+	if previous != nil && sameRegistry(previous.cfg, cfg) {
+		rt.registryClient = previous.registryClient
+		for _, service := range previous.services {
+			previousServices[service.Name] = service
+		}
+	} else {
+		var registryTLS *tls.Config
+		if cfg.RegistryTLS.IsSet() {
+			var err error
+			registryTLS, err = tlsutil.NewClientConfig(clientTLSOptions(cfg.RegistryTLS))
+			if err != nil {
+				return nil, fmt.Errorf("invalid registry TLS settings: %w", err)
+			}
+		}
+		serviceRegistryClient, err := registry.NewServiceRegistryClient(cfg.ServiceRegistryType, cfg.ServiceRegsistryUrl, registryTLS)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize service registry client: %w", err)
+		}
+		rt.registryClient = serviceRegistryClient
+		rt.ownsRegistry = true
+	}
+
+	retryBudget := proxy.NewRetryBudget(cfg.RetryBudget.Percent, cfg.RetryBudget.MinRetriesPerSecond)
+
+	serviceHandlers := make(map[string]http.Handler, len(cfg.Services))
+	for _, svc := range cfg.Services {
+		var service *Service
+		if previousService := previousServices[svc.Name]; previousService != nil && reflect.DeepEqual(previousService.config, svc) {
+			service = &Service{
+				Name:         svc.Name,
+				StrategyName: svc.Strategy,
+				Backends:     previousService.Backends,
+				Strategy:     previousService.Strategy,
+				config:       svc,
+				cancel:       previousService.cancel,
+			}
+			log.Printf("Service %q unchanged, keeping its backends", svc.Name)
+		} else {
+			var err error
+			service, err = newService(svc, rt.registryClient, store)
+			if err != nil {
+				rt.Stop()
+				return nil, err
+			}
+			log.Printf("Service %q configured with strategy: %s", svc.Name, svc.Strategy)
+		}
+		rt.services = append(rt.services, service)
+
+		// already validated with the rest of the config
+		flushInterval, _ := config.ParseOptionalDuration(svc.Streaming.FlushInterval)
+		idleTimeout, _ := config.ParseOptionalDuration(svc.Streaming.IdleTimeout)
+		serviceHandlers[svc.Name] = proxy.NewReverseProxyHandler(service.Strategy, proxy.ProxyOptions{
+			Retry: proxy.RetryOptions{
+				MaxRetries:   svc.Retries.MaxRetries,
+				MaxBodyBytes: svc.Retries.MaxBodyBytes,
+			},
+			RetryBudget: retryBudget,
+			Streaming: proxy.StreamingOptions{
+				FlushInterval: flushInterval,
+				IdleTimeout:   idleTimeout,
+			},
+		})
+	}
+
+	lbRouter := router.NewRouter()
+	for _, route := range cfg.Routes {
+		handler := serviceHandlers[route.Service]
+		if route.RateLimit.RequestsPerSecond > 0 {
+			handler = ratelimit.NewLimiter(ratelimit.Options{
+				Route:             route.Name,
+				RequestsPerSecond: route.RateLimit.RequestsPerSecond,
+				Burst:             route.RateLimit.Burst,
+				Key:               route.RateLimit.Key,
+				KeyName:           route.RateLimit.KeyName,
+				MaxKeys:           route.RateLimit.MaxKeys,
+			}).Handler(handler)
+		}
+		if err := lbRouter.AddRoute(route, handler); err != nil {
+			rt.Stop()
+			return nil, fmt.Errorf("failed to add route for service %q: %w", route.Service, err)
+		}
+	}
+	// already validated with the rest of the config
+	trustedProxies, _ := netutil.ParseCIDRs(cfg.Forwarded.TrustedCIDRs)
+	rt.handler = forwarded.NewHandler(trustedProxies, lbRouter)
+
+	return rt, nil
+}
+
+func (rt *Runtime) Config() *config.Config {
+	return rt.cfg
+}
+
+func (rt *Runtime) Services() []*Service {
+	return rt.services
+}
+
+func (rt *Runtime) Service(name string) *Service {
+	for _, service := range rt.services {
+		if service.Name == name {
+			return service
+		}
+	}
+	return nil
+}
+
+// discovers and health checks every new pool once, then keeps them up to date in the background;
+// pools kept from the previous runtime are already running. The error reports a registry that could
+// not be reached, the pools are started regardless and keep retrying
+func (rt *Runtime) Start() error {
+	var discoveryErr error
+	for _, service := range rt.services {
+		if service.cancel != nil {
+			continue
+		}
+		if err := service.Backends.Refresh(); err != nil && discoveryErr == nil {
+			discoveryErr = fmt.Errorf("failed to discover backends for service %q: %w", service.Name, err)
+		}
+	}
+
+	for _, service := range rt.services {
+		if service.cancel != nil {
+			continue
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		service.cancel = cancel
+		go service.Backends.StartBackendDiscovery(ctx)
+		go service.Backends.StartHealthChecks(ctx)
+		go service.Backends.StartOutlierDetection(ctx)
+	}
+	return discoveryErr
+}
+
+// takes the kept pools and registry client over from the runtime being replaced,
+// which from then on stops only what it does not share
+func (rt *Runtime) takeOver(previous *Runtime) {
+	for _, service := range rt.services {
+		if service.owned {
+			continue
+		}
+		service.owned = true
+		if previousService := previous.Service(service.Name); previousService != nil {
+			previousService.owned = false
+		}
+	}
+	if !rt.ownsRegistry {
+		rt.ownsRegistry = true
+		previous.ownsRegistry = false
+	}
+}
+
+// carries backends disabled or drained by an operator over to rebuilt pools
+func (rt *Runtime) inheritAdminState(previous *Runtime) {
+	for _, previousService := range previous.services {
+		for _, service := range rt.services {
+			if service.Name != previousService.Name || service.Backends == previousService.Backends {
+				continue
+			}
+			for _, previousBackend := range previousService.Backends.Backends() {
+				if previousBackend.IsDisabled() {
+					service.Backends.Disable(previousBackend.InstanceID)
+				}
+			}
+			for _, instanceID := range previousService.Backends.DrainedInstances() {
+				service.Backends.Drain(instanceID)
+			}
+		}
+	}
+}
+
+func (rt *Runtime) Stop() {
+	for _, service := range rt.services {
+		if !service.owned {
+			continue
+		}
+		if service.cancel != nil {
+			service.cancel()
+		}
+		service.Backends.Stop()
+	}
+	if rt.ownsRegistry {
+		rt.closeRegistryClient()
+	}
+}
+
+func (rt *Runtime) closeRegistryClient() {
+	if grpcClient, ok := rt.registryClient.(*registry.GRPCRegistryClient); ok {
+		grpcClient.Close()
+	}
+}
+
+func (rt *Runtime) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rt.inFlight.Add(1)
+	defer rt.inFlight.Add(-1)
+	rt.handler.ServeHTTP(w, r)
+}
+
+func (rt *Runtime) InFlight() int64 {
+	return rt.inFlight.Load()
+}
+
+func newService(svc config.ServiceConfig, serviceRegistryClient registry.ServiceRegistryClient, store sessionstore.Store) (*Service, error) {
+	backendManager, err := balancer.NewBackendManager(serviceRegistryClient, svc.Name, svc.HealthCheckInterval, svc.HealthCheckTimeout, svc.BackendHealthPath)
+	if err != nil {
+		return nil, fmt.Errorf("invalid health check settings for service %q: %w", svc.Name, err)
+	}
+	service := &Service{
+		Name:         svc.Name,
+		StrategyName: svc.Strategy,
+		Backends:     backendManager,
+		config:       svc,
+		owned:        true,
+	}
+	backendManager.SetConfiguredWeights(svc.Weights)
+	backendManager.SetHealthCheckOptions(healthCheckOptions(svc.HealthCheck))
+	breakerOptions, err := circuitBreakerOptions(svc)
+	if err != nil {
+		backendManager.Stop()
+		return nil, fmt.Errorf("invalid circuit breaker settings for service %q: %w", svc.Name, err)
+	}
+	backendManager.SetCircuitBreakerOptions(breakerOptions)
+	if svc.OutlierDetection.Enabled {
+		backendManager.EnableOutlierDetection(outlierDetectionOptions(svc.OutlierDetection))
+	}
+	drainTimeout, err := config.ParseOptionalDuration(svc.DrainTimeout)
+	if err != nil {
+		backendManager.Stop()
+		return nil, fmt.Errorf("invalid drain timeout for service %q: %w", svc.Name, err)
+	}
+	backendManager.SetDrainTimeout(drainTimeout)
+	transportOptions, err := transportOptions(svc)
+	if err != nil {
+		backendManager.Stop()
+		return nil, fmt.Errorf("invalid transport settings for service %q: %w", svc.Name, err)
+	}
+	backendManager.SetTransportOptions(transportOptions)
+
+	lbStrategy, err := balancer.NewStrategy(svc.Strategy, backendManager, strategyOptions(svc, store))
+	if err != nil {
+		backendManager.Stop()
+		return nil, fmt.Errorf("failed to initialize strategy for service %q: %w", svc.Name, err)
+	}
+	service.Strategy = lbStrategy
+	return service, nil
+}
+
+func sameRegistry(a, b *config.Config) bool {
+	return a.ServiceRegistryType == b.ServiceRegistryType &&
+		a.ServiceRegsistryUrl == b.ServiceRegsistryUrl &&
+		reflect.DeepEqual(a.RegistryTLS, b.RegistryTLS)
+}
+
+func strategyOptions(svc config.ServiceConfig, store sessionstore.Store) balancer.StrategyOptions {
+	stickySessions := stickySessionOptions(svc.StickySessions)
+	stickySessions.Store = store
+	stickySessions.Namespace = svc.Name
+	return balancer.StrategyOptions{
+		ConsistentHash: balancer.ConsistentHashOptions{
+			Key:          svc.ConsistentHash.Key,
+			KeyName:      svc.ConsistentHash.KeyName,
+			PathSegment:  svc.ConsistentHash.PathSegment,
+			VirtualNodes: svc.ConsistentHash.VirtualNodes,
+			LoadFactor:   svc.ConsistentHash.LoadFactor,
+		},
+		StickySessions: stickySessions,
+	}
+}
+
+func stickySessionOptions(ss config.StickySessionsConfig) balancer.StickySessionOptions {
+	// already validated with the rest of the config
+	ttl, _ := config.ParseOptionalDuration(ss.TTL)
+	options := balancer.StickySessionOptions{
+		CookieName: ss.CookieName,
+		TTL:        ttl,
+		Path:       ss.Path,
+		Domain:     ss.Domain,
+		Secure:     ss.Secure,
+		HTTPOnly:   ss.HTTPOnly,
+	}
+	if ss.Secret != "" {
+		options.Secret = []byte(ss.Secret)
+	}
+	switch ss.SameSite {
+	case "lax":
+		options.SameSite = http.SameSiteLaxMode
+	case "strict":
+		options.SameSite = http.SameSiteStrictMode
+	case "none":
+		options.SameSite = http.SameSiteNoneMode
+	}
+	return options
+}
+
+func healthCheckOptions(hc config.HealthCheckConfig) balancer.HealthCheckOptions {
+	// already validated with the rest of the config
+	statuses, _ := healthcheck.ParseStatusRanges(hc.ExpectedStatuses)
+	jitter, _ := config.ParseOptionalDuration(hc.Jitter)
+	options := balancer.HealthCheckOptions{
+		Check: healthcheck.Options{
+			Type: hc.Type,
+			HTTP: healthcheck.HTTPOptions{
+				Method:           hc.Method,
+				Headers:          hc.Headers,
+				Host:             hc.Host,
+				ExpectedStatuses: statuses,
+				JSONField:        hc.JSONField,
+				JSONValue:        hc.JSONValue,
+			},
+			GRPCService: hc.GRPCService,
+		},
+		HealthyThreshold:    hc.HealthyThreshold,
+		UnhealthyThreshold:  hc.UnhealthyThreshold,
+		Jitter:              jitter,
+		MaxConcurrentProbes: hc.MaxConcurrentProbes,
+	}
+	if hc.BodyRegex != "" {
+		options.Check.HTTP.BodyRegex = regexp.MustCompile(hc.BodyRegex)
+	}
+	return options
+}
+
+func circuitBreakerOptions(svc config.ServiceConfig) (balancer.CircuitBreakerOptions, error) {
+	window, err := config.ParseOptionalDuration(svc.CircuitBreaker.Window)
+	if err != nil {
+		return balancer.CircuitBreakerOptions{}, err
+	}
+	openDuration, err := config.ParseOptionalDuration(svc.CircuitBreaker.OpenDuration)
+	if err != nil {
+		return balancer.CircuitBreakerOptions{}, err
+	}
+
+	return balancer.CircuitBreakerOptions{
+		ConsecutiveFailures: svc.CircuitBreaker.ConsecutiveFailures,
+		ErrorRateThreshold:  svc.CircuitBreaker.ErrorRateThreshold,
+		MinRequests:         svc.CircuitBreaker.MinRequests,
+		Window:              window,
+		OpenDuration:        openDuration,
+		HalfOpenRequests:    svc.CircuitBreaker.HalfOpenRequests,
+	}, nil
+}
+
+func outlierDetectionOptions(od config.OutlierDetectionConfig) balancer.OutlierDetectionOptions {
+	// already validated with the rest of the config
+	interval, _ := config.ParseOptionalDuration(od.Interval)
+	baseEjectionTime, _ := config.ParseOptionalDuration(od.BaseEjectionTime)
+	maxEjectionTime, _ := config.ParseOptionalDuration(od.MaxEjectionTime)
+	slowResponseThreshold, _ := config.ParseOptionalDuration(od.SlowResponseThreshold)
+	return balancer.OutlierDetectionOptions{
+		Consecutive5xx:            od.Consecutive5xx,
+		ConsecutiveGatewayFailure: od.ConsecutiveGatewayFailure,
+		Interval:                  interval,
+		BaseEjectionTime:          baseEjectionTime,
+		MaxEjectionTime:           maxEjectionTime,
+		MaxEjectionPercent:        od.MaxEjectionPercent,
+		SuccessRateMinimumHosts:   od.SuccessRateMinimumHosts,
+		SuccessRateRequestVolume:  od.SuccessRateRequestVolume,
+		SuccessRateStdevFactor:    od.SuccessRateStdevFactor,
+		SlowResponseThreshold:     slowResponseThreshold,
+	}
+}
+
+func transportOptions(svc config.ServiceConfig) (balancer.TransportOptions, error) {
+	t := svc.Transport
+	options := balancer.TransportOptions{
+		MaxIdleConnsPerHost: t.MaxIdleConnsPerHost,
+		DisableHTTP2:        t.DisableHTTP2,
+	}
+	if t.TLS.IsSet() {
+		tlsConfig, err := tlsutil.NewClientConfig(clientTLSOptions(t.TLS))
+		if err != nil {
+			return balancer.TransportOptions{}, err
+		}
+		options.TLSConfig = tlsConfig
+	}
+	durations := []struct {
+		value  string
+		target *time.Duration
+	}{
+		{t.IdleConnTimeout, &options.IdleConnTimeout},
+		{t.DialTimeout, &options.DialTimeout},
+		{t.KeepAlive, &options.KeepAlive},
+		{t.ResponseHeaderTimeout, &options.ResponseHeaderTimeout},
+		{t.TLSHandshakeTimeout, &options.TLSHandshakeTimeout},
+	}
+	for _, d := range durations {
+		parsed, err := config.ParseOptionalDuration(d.value)
+		if err != nil {
+			return balancer.TransportOptions{}, err
+		}
+		*d.target = parsed
+	}
+	return options, nil
+}
+
+func clientTLSOptions(t config.ClientTLSConfig) tlsutil.ClientOptions {
+	return tlsutil.ClientOptions{
+		CAFile:             t.CAFile,
+		CertFile:           t.CertFile,
+		KeyFile:            t.KeyFile,
+		ServerName:         t.ServerName,
+		InsecureSkipVerify: t.InsecureSkipVerify,
+	}
+}
@@ -2,9 +2,15 @@ package balancer
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"maps"
+	"math"
+	"math/rand/v2"
+	"net/http"
 	"net/url"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/lokeshllkumar/load-balancer/internal/healthcheck"
@@ -15,21 +21,54 @@ import (
 type Backend struct {
 	URL         *url.URL
 	Alive       bool
-	Connections int32
+	connections atomic.Int32 // read on every request, so kept out of mux
+	longLived   atomic.Int32 // upgraded connections and event streams, not counted in connections
 	mux         sync.RWMutex // keeping it private
 	LastError   time.Time
 	ErrorCount  int
 	HealthPath  string
 	InstanceID  string
+	Weight      int
+	Metadata    map[string]string // reported by the registry, replaced rather than modified
+	latencyEWMA float64 // nanoseconds, peak-sensitive
+	latencyAt   time.Time
+	breaker     *CircuitBreaker
+	transport   *http.Transport // owned by the backend, so idle connections are pooled per backend
+	disabled    bool // set by an operator, excluded from selection until re-enabled
+	draining    bool // no new requests, the in-flight ones may finish
+	circuitOpen bool
+	healthChecked   bool // whether any probe has finished yet
+	healthSuccesses int // consecutive, reset by a failure
+	healthFailures  int // consecutive, reset by a success
+	outlier         outlierState
+	outlierDetector *OutlierDetector // nil when outlier detection is off
+	// set by the manager to republish its healthy snapshot; called without mux held
+	onAvailabilityChange func()
 }
 
+const (
+	// how quickly past latency samples stop mattering
+	latencyDecayTime = 10 * time.Second
+	// assumed latency of backends that have not served a request yet
+	defaultLatency = 30 * time.Millisecond
+	// how long to wait before re-opening a registry watch that failed or broke
+	watchRetryInterval = 30 * time.Second
+	// how long a draining backend's in-flight requests may take before it is removed anyway
+	defaultDrainTimeout = 30 * time.Second
+	drainPollInterval   = 100 * time.Millisecond
+)
+
 func (b *Backend) SetAlive(alive bool) {
 	b.mux.Lock()
+	changed := b.Alive != alive
 	b.Alive = alive
 	if alive {
 		b.ErrorCount = 0
 	}
 	b.mux.Unlock()
+	if changed {
+		b.availabilityChanged()
+	}
 }
 
 func (b *Backend) IsAlive() bool {
@@ -40,78 +79,303 @@ func (b *Backend) IsAlive() bool {
 }
 
 func (b *Backend) IncrementConnections() {
+	conn := b.connections.Add(1)
+	metrics.ActiveConnectionsGauge.WithLabelValues(b.URL.Host, b.InstanceID).Set(float64(conn))
+}
+
+func (b *Backend) DecrementConnections() {
+	for {
+		conn := b.connections.Load()
+		if conn <= 0 {
+			return
+		}
+		if b.connections.CompareAndSwap(conn, conn-1) {
+			metrics.ActiveConnectionsGauge.WithLabelValues(b.URL.Host, b.InstanceID).Set(float64(conn - 1))
+			return
+		}
+	}
+}
+
+func (b *Backend) GetConnections() int32 {
+	return b.connections.Load()
+}
+
+// moves a request that turned into an upgraded connection or event stream out of the request/response count
+func (b *Backend) PromoteToLongLived() {
+	b.DecrementConnections()
+	conn := b.longLived.Add(1)
+	metrics.LongLivedConnectionsGauge.WithLabelValues(b.URL.Host, b.InstanceID).Set(float64(conn))
+}
+
+func (b *Backend) DecrementLongLived() {
+	conn := b.longLived.Add(-1)
+	metrics.LongLivedConnectionsGauge.WithLabelValues(b.URL.Host, b.InstanceID).Set(float64(conn))
+}
+
+func (b *Backend) GetLongLivedConnections() int32 {
+	return b.longLived.Load()
+}
+
+func (b *Backend) SetWeight(weight int) {
 	b.mux.Lock()
-	b.Connections++
-	metrics.ActiveConnectionsGauge.WithLabelValues(b.URL.Host, b.InstanceID).Set(float64(b.Connections))
+	b.Weight = weight
 	b.mux.Unlock()
 }
 
-func (b *Backend) DecrementConnections() {
+func (b *Backend) GetMetadata() map[string]string {
+	b.mux.RLock()
+	defer b.mux.RUnlock()
+	return b.Metadata
+}
+
+func (b *Backend) setMetadata(metadata map[string]string) {
 	b.mux.Lock()
-	if b.Connections > 0 {
-		b.Connections--
-	}
-	metrics.ActiveConnectionsGauge.WithLabelValues(b.URL.Host, b.InstanceID).Set(float64(b.Connections))
+	b.Metadata = metadata
 	b.mux.Unlock()
 }
 
-func (b *Backend) GetConnections() int32 {
+// weights below 1 are treated as 1 so every healthy backend still receives traffic
+func (b *Backend) GetWeight() int {
 	b.mux.RLock()
-	conn := b.Connections
+	weight := b.Weight
 	b.mux.RUnlock()
-	return conn
+	if weight < 1 {
+		return 1
+	}
+	return weight
 }
 
+// jumps straight up to slower samples and decays exponentially towards faster ones
+func (b *Backend) RecordLatency(latency time.Duration) {
+	b.mux.Lock()
+	sample := float64(latency)
+	if b.latencyAt.IsZero() || sample > b.latencyEWMA {
+		b.latencyEWMA = sample
+	} else {
+		w := math.Exp(-float64(time.Since(b.latencyAt)) / float64(latencyDecayTime))
+		b.latencyEWMA = b.latencyEWMA*w + sample*(1-w)
+	}
+	b.latencyAt = time.Now()
+	b.mux.Unlock()
+}
+
+// the latency average decayed to now, so a backend that turned slow gets retried once it stops being picked
+func (b *Backend) GetLatencyEWMA() time.Duration {
+	b.mux.RLock()
+	defer b.mux.RUnlock()
+	if b.latencyAt.IsZero() {
+		return defaultLatency
+	}
+	w := math.Exp(-float64(time.Since(b.latencyAt)) / float64(latencyDecayTime))
+	return time.Duration(b.latencyEWMA * w)
+}
+
+// counts a failed request towards the backend's circuit breaker
 func (b *Backend) RecordError() {
 	b.mux.Lock()
 	b.ErrorCount++
 	b.LastError = time.Now()
-	// simple circuit breaker - if there any too many errors in a short span of time, mark unhealthy
-	if b.ErrorCount > 4 && time.Since(b.LastError) < 10*time.Second {
-		if b.Alive {
-			b.Alive = false
-			log.Printf("Backend %s (%s) marked unhealthy due to repeated errors", b.URL.String(), b.InstanceID)
-			metrics.ActiveConnectionsGauge.WithLabelValues(b.URL.Host, b.InstanceID).Set(0)
-		}
+	b.mux.Unlock()
+
+	if b.breaker != nil {
+		b.breaker.RecordFailure()
+	}
+}
+
+func (b *Backend) RecordSuccess() {
+	b.mux.Lock()
+	b.ErrorCount = 0
+	b.mux.Unlock()
+
+	if b.breaker != nil {
+		b.breaker.RecordSuccess()
+	}
+}
+
+// reserves a request slot with the circuit breaker; must be followed by RecordSuccess, RecordError or ReleaseRequest
+func (b *Backend) AllowRequest() bool {
+	return b.breaker == nil || b.breaker.Allow()
+}
+
+// gives back a slot reserved by AllowRequest when the request ended without saying anything about the backend
+func (b *Backend) ReleaseRequest() {
+	if b.breaker != nil {
+		b.breaker.Release()
+	}
+}
+
+func (b *Backend) CircuitState() CircuitState {
+	if b.breaker == nil {
+		return CircuitClosed
+	}
+	return b.breaker.State()
+}
+
+func (b *Backend) SetDisabled(disabled bool) {
+	b.mux.Lock()
+	changed := b.disabled != disabled
+	b.disabled = disabled
+	b.mux.Unlock()
+	if changed {
+		b.availabilityChanged()
+	}
+}
+
+func (b *Backend) IsDisabled() bool {
+	b.mux.RLock()
+	disabled := b.disabled
+	b.mux.RUnlock()
+	return disabled
+}
+
+// reports whether the backend was not draining already
+func (b *Backend) setDraining(draining bool) bool {
+	b.mux.Lock()
+	changed := b.draining != draining
+	b.draining = draining
+	b.mux.Unlock()
+	if changed {
+		b.availabilityChanged()
+	}
+	return changed
+}
+
+func (b *Backend) IsDraining() bool {
+	b.mux.RLock()
+	draining := b.draining
+	b.mux.RUnlock()
+	return draining
+}
+
+// healthy, taking new requests and not rejected by its circuit breaker
+func (b *Backend) IsAvailable() bool {
+	b.mux.RLock()
+	available := b.Alive && !b.disabled && !b.draining && !b.outlier.ejected
+	b.mux.RUnlock()
+	return available && (b.breaker == nil || b.breaker.Ready())
+}
+
+// whether the backend belongs in the healthy snapshot strategies pick from; half-open breakers
+// are included and enforce their probe limit through AllowRequest
+func (b *Backend) TakesTraffic() bool {
+	b.mux.RLock()
+	defer b.mux.RUnlock()
+	return b.Alive && !b.disabled && !b.draining && !b.circuitOpen && !b.outlier.ejected
+}
+
+func (b *Backend) availabilityChanged() {
+	if b.onAvailabilityChange != nil {
+		b.onAvailabilityChange()
 	}
+}
+
+func (b *Backend) Transport() http.RoundTripper {
+	if b.transport == nil {
+		return http.DefaultTransport
+	}
+	return b.transport
+}
+
+func (b *Backend) closeTransport() {
+	if b.transport != nil {
+		b.transport.CloseIdleConnections()
+	}
+}
+
+func (b *Backend) onCircuitStateChange(from CircuitState, to CircuitState) {
+	log.Printf("Circuit breaker for backend %s (ID: %s) changed from %s to %s", b.URL.String(), b.InstanceID, from, to)
+	metrics.CircuitBreakerStateGauge.WithLabelValues(b.URL.Host, b.InstanceID).Set(float64(to))
+	metrics.CircuitBreakerTransitions.WithLabelValues(b.URL.Host, b.InstanceID, from.String(), to.String()).Inc()
+
+	b.mux.Lock()
+	changed := b.circuitOpen != (to == CircuitOpen)
+	b.circuitOpen = to == CircuitOpen
 	b.mux.Unlock()
+	if changed {
+		b.availabilityChanged()
+	}
 }
 
 type BackendManager struct {
 	backends           []*Backend
 	mu                 sync.RWMutex
 	serviceRegistry    registry.ServiceRegistryClient
+	serviceName        string // empty to accept every registered instance
+	defaultHealthPath  string // used when the registry does not report one
+	configuredWeights  map[string]int // by instance ID, used when the registry does not report a weight
+	breakerOptions     CircuitBreakerOptions
+	transportOptions   TransportOptions
+	drainTimeout       time.Duration
+	drained            map[string]bool // instance IDs drained by an operator, kept out of the pool while still registered
+	healthy            atomic.Pointer[[]*Backend] // immutable, republished whenever membership or availability changes
+	snapshotMu         sync.Mutex // serializes republishing, so an older snapshot never replaces a newer one
 	healthCheckTicker  *time.Ticker
 	discoveryTicker    *time.Ticker
+	healthCheckInterval time.Duration
 	healthCheckTimeout time.Duration
+	healthOptions      HealthCheckOptions
+	healthTransport    *http.Transport // shared by the probes of every backend in the pool
+	healthCheckers     *healthcheck.Checkers
+	probeSlots         chan struct{} // caps the probes in flight
+	outlierDetector    *OutlierDetector
 	stopChan           chan struct{}
 }
 
-func NewBackendManager(serviceRegistryClient registry.ServiceRegistryClient, healthCheckInterval string, healthCheckTimeout string) *BackendManager { // store the interval and timeout as strings
+func NewBackendManager(serviceRegistryClient registry.ServiceRegistryClient, serviceName string, healthCheckInterval string, healthCheckTimeout string, healthPath string) (*BackendManager, error) { // store the interval and timeout as strings
+	// also reached on config reloads, so a bad value must fail the reload instead of the process
 	hInterval, err := time.ParseDuration(healthCheckInterval)	
-	if err != nil {
-		log.Fatalf("Invalid health check interval duration: %v", err)
+	if err != nil || hInterval <= 0 {
+		return nil, fmt.Errorf("invalid health check interval %q", healthCheckInterval)
 	}
 	hTimeout, err := time.ParseDuration(healthCheckTimeout)
-	if err != nil {
-		log.Fatalf("Invalid health check timeout duration: %v", err)
+	if err != nil || hTimeout <= 0 {
+		return nil, fmt.Errorf("invalid health check timeout %q", healthCheckTimeout)
 	}
 
-	return &BackendManager{
+	bm := &BackendManager{
 		backends: make([]*Backend, 0),
 		serviceRegistry: serviceRegistryClient,
+		serviceName: serviceName,
+		defaultHealthPath: healthPath,
 		healthCheckTicker: time.NewTicker(hInterval),
 		discoveryTicker: time.NewTicker(hInterval * 2),
+		healthCheckInterval: hInterval,
 		healthCheckTimeout: hTimeout,
+		healthOptions: HealthCheckOptions{}.withDefaults(hInterval),
+		healthTransport: newHealthTransport(TransportOptions{}),
+		drainTimeout: defaultDrainTimeout,
+		drained: make(map[string]bool),
 		stopChan: make(chan struct{}),
 	}
+	bm.healthCheckers = healthcheck.NewCheckers(bm.healthOptions.Check, bm.healthTransport)
+	bm.probeSlots = make(chan struct{}, bm.healthOptions.MaxConcurrentProbes)
+	bm.publishHealthyBackends()
+	return bm, nil
 }
 
 func (bm *BackendManager) StartBackendDiscovery(ctx context.Context) {
 	log.Println("Starting backedn discovery...")
 	bm.discoverBackends()
+
+	// changes are pushed through a registry watch when possible; polling covers the time the watch is down
+	watchRetry := time.NewTimer(0)
+	defer watchRetry.Stop()
 	for {
 		select {
+		case <- watchRetry.C:
+			bm.watchBackends(ctx)
+			select {
+			case <- bm.stopChan:
+				log.Println("Backend discovery stopped")
+				return
+			case <- ctx.Done():
+				log.Println("Backend discovery cotnext cancelled")
+				return
+			default:
+			}
+			// catching up on anything missed while the stream was down
+			bm.discoverBackends()
+			watchRetry.Reset(watchRetryInterval)
 		case <- bm.discoveryTicker.C:
 			bm.discoverBackends()
 		case <- bm.stopChan:
@@ -124,16 +388,61 @@ func (bm *BackendManager) StartBackendDiscovery(ctx context.Context) {
 	}
 }
 
-func (bm *BackendManager) discoverBackends() {
-	log.Println("Discovering backends from service registry...")
+// applies registry watch events until the stream breaks or the manager is stopped
+func (bm *BackendManager) watchBackends(ctx context.Context) {
+	watchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	events, err := bm.serviceRegistry.WatchServices(watchCtx)
+	if err != nil {
+		log.Printf("Failed to watch service registry for service %q, polling instead: %v", bm.serviceName, err)
+		return
+	}
+	log.Printf("Watching service registry for changes to service %q", bm.serviceName)
+
+	// the initial burst of added instances is a full snapshot, reconciled as a whole once synced
+	synced := false
+	snapshot := make([]registry.ServiceInstance, 0)
+	for {
+		select {
+		case event, ok := <- events:
+			if !ok {
+				log.Printf("Service registry watch for service %q ended, falling back to polling", bm.serviceName)
+				return
+			}
+			if synced {
+				bm.applyServiceEvent(event)
+			} else if event.Type == registry.ServicesSynced {
+				bm.reconcileBackends(snapshot)
+				synced = true
+			} else if event.Type != registry.ServiceRemoved {
+				snapshot = append(snapshot, event.Instance)
+			}
+		case <- bm.stopChan:
+			return
+		case <- ctx.Done():
+			return
+		}
+	}
+}
+
+func (bm *BackendManager) discoverBackends() error {
+	log.Printf("Discovering backends for service %q from service registry...", bm.serviceName)
 	registeredServices, err := bm.serviceRegistry.GetServices()
 	if err != nil {
 		log.Printf("Failed to fetch services frpm registry: %v", err)
-		return
+		return err
 	}
+	bm.reconcileBackends(registeredServices)
+	return nil
+}
 
+// replaces the backend list with the given full set of registered instances;
+// instances no longer reported are drained rather than dropped
+func (bm *BackendManager) reconcileBackends(registeredServices []registry.ServiceInstance) {
 	newBackends := make([]*Backend, 0, len(registeredServices))
 	existingBackendsMap := make(map[string]*Backend)
+	discovered := make(map[*Backend]bool)
 
 	bm.mu.RLock()
 	for _, b := range bm.backends {
@@ -142,39 +451,307 @@ func (bm *BackendManager) discoverBackends() {
 	bm.mu.RUnlock()
 
 	for _, s := range registeredServices {
-		backendURL, err := url.Parse(s.URL)
-		if err != nil {
-			log.Printf("Invalid backend URL received from registry: %s, error: %v", s.URL, err)
+		if !bm.accepts(s) {
 			continue
 		}
 
 		if existingBackend, found := existingBackendsMap[s.ID]; found {
-			// yet to implement backend updation if props change
+			// yet to implement backend updation if props change, other than weights
+			bm.updateBackend(existingBackend, s)
 			newBackends = append(newBackends, existingBackend)
 			delete(existingBackendsMap, s.ID) // cleanup
-		} else {
-			newBackend := &Backend{
-				URL: backendURL,
-				Alive: false,
-				HealthPath: s.HealthPath,
-				InstanceID: s.ID,
+		} else if !bm.isDrained(s.ID) {
+			newBackend, err := bm.newBackend(s)
+			if err != nil {
+				log.Printf("Invalid backend URL received from registry: %s, error: %v", s.URL, err)
+				continue
 			}
 			newBackends = append(newBackends, newBackend)
+			discovered[newBackend] = true
 			log.Printf("Discovered new backend: %s (ID: %s)", newBackend.URL.String(), newBackend.InstanceID)
 		}
 	}
 
+	// deregsitered/unresponsive backends stay in the pool until they have drained
+	for _, removedBackend := range existingBackendsMap {
+		newBackends = append(newBackends, removedBackend)
+		bm.drainBackend(removedBackend, "deregistered or no longer reported")
+	}
+
 	bm.mu.Lock()
-	bm.backends = newBackends
+	// backends that finished draining while the registry was being read must not come back
+	current := make(map[*Backend]bool, len(bm.backends))
+	for _, b := range bm.backends {
+		current[b] = true
+	}
+	kept := newBackends[:0]
+	for _, b := range newBackends {
+		if discovered[b] || current[b] {
+			kept = append(kept, b)
+		}
+	}
+	bm.backends = kept
 	bm.mu.Unlock()
+	bm.publishHealthyBackends()
 
-	// cleaning up deregsitered/unresponsive backends
-	for _, removedBackend := range existingBackendsMap {
-		log.Printf("Backend %s (ID: %s) removed (deregistered or no longer reported)", removedBackend.URL.String(), removedBackend.InstanceID)
-		metrics.BackendStatusGauge.WithLabelValues(removedBackend.URL.Host, removedBackend.InstanceID).Set(0)
-		metrics.ActiveConnectionsGauge.WithLabelValues(removedBackend.URL.Host, removedBackend.InstanceID).Set(0)
+	log.Printf("Finished backend discovery. There are currently %d backends available for service %q", len(kept), bm.serviceName)
+}
+
+// applies a single change pushed by the registry watch
+func (bm *BackendManager) applyServiceEvent(event registry.ServiceEvent) {
+	s := event.Instance
+	if !bm.accepts(s) {
+		return
+	}
+
+	switch event.Type {
+	case registry.ServiceAdded, registry.ServiceUpdated:
+		if existingBackend := bm.findBackend(s.ID); existingBackend != nil {
+			bm.updateBackend(existingBackend, s)
+			return
+		}
+		if bm.isDrained(s.ID) {
+			return
+		}
+		newBackend, err := bm.newBackend(s)
+		if err != nil {
+			log.Printf("Invalid backend URL received from registry: %s, error: %v", s.URL, err)
+			return
+		}
+		bm.mu.Lock()
+		bm.backends = append(bm.backends, newBackend)
+		bm.mu.Unlock()
+		bm.publishHealthyBackends()
+		log.Printf("Discovered new backend: %s (ID: %s)", newBackend.URL.String(), newBackend.InstanceID)
+	case registry.ServiceRemoved:
+		if removedBackend := bm.findBackend(s.ID); removedBackend != nil {
+			bm.drainBackend(removedBackend, "deregistered")
+		}
 	}
-	log.Printf("Finished backend discovery. There are currently %d backends available", len(bm.backends))
+}
+
+// stops sending new requests to the backend and removes it once its connections
+// have finished or the drain timeout has passed
+func (bm *BackendManager) drainBackend(b *Backend, reason string) {
+	if !b.setDraining(true) {
+		return
+	}
+	bm.mu.RLock()
+	drainTimeout := bm.drainTimeout
+	bm.mu.RUnlock()
+
+	log.Printf("Draining backend %s (ID: %s), %s, with %d connection(s) in flight", b.URL.String(), b.InstanceID, reason, b.GetConnections()+b.GetLongLivedConnections())
+	go bm.awaitDrain(b, drainTimeout)
+}
+
+func (bm *BackendManager) awaitDrain(b *Backend, drainTimeout time.Duration) {
+	deadline := time.NewTimer(drainTimeout)
+	defer deadline.Stop()
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+
+	for b.GetConnections()+b.GetLongLivedConnections() > 0 {
+		select {
+		case <- ticker.C:
+		case <- deadline.C:
+			log.Printf("Backend %s (ID: %s) did not drain within %v, removing it with %d connection(s) in flight", b.URL.String(), b.InstanceID, drainTimeout, b.GetConnections()+b.GetLongLivedConnections())
+			bm.removeBackend(b)
+			return
+		case <- bm.stopChan:
+			return
+		}
+	}
+	bm.removeBackend(b)
+}
+
+// only removes backends that are still draining, so a re-registered or re-enabled one stays
+func (bm *BackendManager) removeBackend(b *Backend) {
+	bm.mu.Lock()
+	if !b.IsDraining() {
+		bm.mu.Unlock()
+		return
+	}
+	remaining := make([]*Backend, 0, len(bm.backends))
+	removed := false
+	for _, existing := range bm.backends {
+		if existing == b {
+			removed = true
+		} else {
+			remaining = append(remaining, existing)
+		}
+	}
+	bm.backends = remaining
+	checkers := bm.healthCheckers
+	bm.mu.Unlock()
+
+	if removed {
+		bm.publishHealthyBackends()
+		log.Printf("Backend %s (ID: %s) drained and removed", b.URL.String(), b.InstanceID)
+		clearBackendMetrics(b)
+		b.closeTransport()
+		checkers.Forget(b.URL)
+	}
+}
+
+func (bm *BackendManager) isDrained(instanceID string) bool {
+	bm.mu.RLock()
+	defer bm.mu.RUnlock()
+	return bm.drained[instanceID]
+}
+
+func (bm *BackendManager) findBackend(instanceID string) *Backend {
+	bm.mu.RLock()
+	defer bm.mu.RUnlock()
+	for _, b := range bm.backends {
+		if b.InstanceID == instanceID {
+			return b
+		}
+	}
+	return nil
+}
+
+func (bm *BackendManager) accepts(s registry.ServiceInstance) bool {
+	return bm.serviceName == "" || s.ServiceName == bm.serviceName
+}
+
+// must not be called with mu held
+func (bm *BackendManager) newBackend(s registry.ServiceInstance) (*Backend, error) {
+	backendURL, err := url.Parse(s.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	healthPath := s.HealthPath
+	if healthPath == "" {
+		healthPath = bm.defaultHealthPath
+	}
+
+	bm.mu.RLock()
+	breakerOptions := bm.breakerOptions
+	transportOptions := bm.transportOptions
+	outlierDetector := bm.outlierDetector
+	bm.mu.RUnlock()
+
+	newBackend := &Backend{
+		URL: backendURL,
+		Alive: false,
+		HealthPath: healthPath,
+		InstanceID: s.ID,
+		Weight: bm.resolveWeight(s),
+		Metadata: s.Metadata,
+	}
+	newBackend.breaker = NewCircuitBreaker(breakerOptions, newBackend.onCircuitStateChange)
+	newBackend.transport = newTransport(transportOptions)
+	newBackend.onAvailabilityChange = bm.publishHealthyBackends
+	newBackend.outlierDetector = outlierDetector
+	return newBackend, nil
+}
+
+func (bm *BackendManager) updateBackend(existingBackend *Backend, s registry.ServiceInstance) {
+	if existingBackend.IsDraining() && !bm.isDrained(s.ID) && existingBackend.setDraining(false) {
+		log.Printf("Backend %s (ID: %s) registered again, no longer draining", existingBackend.URL.String(), existingBackend.InstanceID)
+	}
+	weight := bm.resolveWeight(s)
+	if existingBackend.GetWeight() != weight {
+		log.Printf("Backend %s (ID: %s) weight changed to %d", existingBackend.URL.String(), existingBackend.InstanceID, weight)
+		existingBackend.SetWeight(weight)
+	}
+	if !maps.Equal(existingBackend.GetMetadata(), s.Metadata) {
+		existingBackend.setMetadata(s.Metadata)
+	}
+}
+
+func clearBackendMetrics(b *Backend) {
+	metrics.BackendStatusGauge.WithLabelValues(b.URL.Host, b.InstanceID).Set(0)
+	metrics.ActiveConnectionsGauge.WithLabelValues(b.URL.Host, b.InstanceID).Set(0)
+	metrics.LongLivedConnectionsGauge.WithLabelValues(b.URL.Host, b.InstanceID).Set(0)
+	metrics.CircuitBreakerStateGauge.WithLabelValues(b.URL.Host, b.InstanceID).Set(0)
+	metrics.OutlierEjectedGauge.WithLabelValues(b.URL.Host, b.InstanceID).Set(0)
+}
+
+// registry-reported weights take precedence over the ones set in config.yaml
+func (bm *BackendManager) resolveWeight(s registry.ServiceInstance) int {
+	if s.Weight > 0 {
+		return s.Weight
+	}
+
+	bm.mu.RLock()
+	weight, found := bm.configuredWeights[s.ID]
+	bm.mu.RUnlock()
+	if found && weight > 0 {
+		return weight
+	}
+	return 1
+}
+
+// replaces the fallback weights; applied to existing backends on the next discovery
+func (bm *BackendManager) SetConfiguredWeights(weights map[string]int) {
+	bm.mu.Lock()
+	bm.configuredWeights = weights
+	bm.mu.Unlock()
+}
+
+// applies to drains started after the call; 0 keeps the default
+func (bm *BackendManager) SetDrainTimeout(drainTimeout time.Duration) {
+	if drainTimeout <= 0 {
+		drainTimeout = defaultDrainTimeout
+	}
+	bm.mu.Lock()
+	bm.drainTimeout = drainTimeout
+	bm.mu.Unlock()
+}
+
+// applies to backends discovered after the call
+func (bm *BackendManager) SetCircuitBreakerOptions(options CircuitBreakerOptions) {
+	bm.mu.Lock()
+	bm.breakerOptions = options
+	bm.mu.Unlock()
+}
+
+// turns on outlier detection for backends discovered after the call
+func (bm *BackendManager) EnableOutlierDetection(options OutlierDetectionOptions) {
+	detector := NewOutlierDetector(options, bm.Backends)
+	bm.mu.Lock()
+	bm.outlierDetector = detector
+	bm.mu.Unlock()
+}
+
+// sweeps ejections and success rates every interval until stopped; returns right away when outlier detection is off
+func (bm *BackendManager) StartOutlierDetection(ctx context.Context) {
+	bm.mu.RLock()
+	detector := bm.outlierDetector
+	bm.mu.RUnlock()
+	if detector == nil {
+		return
+	}
+	log.Println("Starting outlier detection...")
+	detector.Run(ctx, bm.stopChan)
+}
+
+// applies from the next round of health checks
+func (bm *BackendManager) SetHealthCheckOptions(options HealthCheckOptions) {
+	options = options.withDefaults(bm.healthCheckInterval)
+	bm.mu.Lock()
+	bm.healthOptions = options
+	previous := bm.healthCheckers
+	bm.healthCheckers = healthcheck.NewCheckers(options.Check, bm.healthTransport)
+	bm.probeSlots = make(chan struct{}, options.MaxConcurrentProbes)
+	bm.mu.Unlock()
+	previous.Close()
+}
+
+// applies to backends discovered after the call, and to health checks from the next round
+func (bm *BackendManager) SetTransportOptions(options TransportOptions) {
+	healthTransport := newHealthTransport(options)
+	bm.mu.Lock()
+	bm.transportOptions = options
+	previous := bm.healthTransport
+	previousCheckers := bm.healthCheckers
+	bm.healthTransport = healthTransport
+	bm.healthCheckers = healthcheck.NewCheckers(bm.healthOptions.Check, healthTransport)
+	bm.mu.Unlock()
+	previous.CloseIdleConnections()
+	previousCheckers.Close()
 }
 
 func(bm *BackendManager) StartHealthChecks(ctx context.Context) {
@@ -182,7 +759,7 @@ func(bm *BackendManager) StartHealthChecks(ctx context.Context) {
 	for {
 		select {
 		case <- bm.healthCheckTicker.C:
-			bm.checkAllBackends()
+			bm.checkAllBackends(true)
 		case <- bm.stopChan:
 			log.Println("Health checks stopped")
 			return
@@ -193,52 +770,204 @@ func(bm *BackendManager) StartHealthChecks(ctx context.Context) {
 	}
 }
 
-func (bm *BackendManager) checkAllBackends() {
+// returns once every probe has finished, which is bounded by the jitter plus the health check timeout
+// for each batch of concurrent probes; spread starts the probes at random offsets instead of all at once
+func (bm *BackendManager) checkAllBackends(spread bool) {
 	bm.mu.RLock()
 	backendsToCheck := make([]*Backend, len(bm.backends))
 	copy(backendsToCheck, bm.backends)
+	jitter := bm.healthOptions.Jitter
+	probeSlots := bm.probeSlots
 	bm.mu.RUnlock()
 
+	var wg sync.WaitGroup
 	for _, backend := range backendsToCheck {
-		go bm.performHealthCheck(backend)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if spread && jitter > 0 {
+				select {
+				case <- time.After(rand.N(jitter)):
+				case <- bm.stopChan:
+					return
+				}
+			}
+			probeSlots <- struct{}{}
+			defer func() { <- probeSlots }()
+			bm.performHealthCheck(backend)
+		}()
 	}
+	wg.Wait()
+}
+
+// discovers and health checks synchronously, so a freshly built pool can take traffic right away;
+// the pool is health checked even when the registry could not be reached, the error only reports that
+func (bm *BackendManager) Refresh() error {
+	err := bm.discoverBackends()
+	bm.checkAllBackends(false)
+	return err
 }
 
 func (bm *BackendManager) performHealthCheck(backend *Backend) {
-	fullHealthURL := backend.URL.String() + backend.HealthPath
-	isHealthy := healthcheck.CheckHTTP(fullHealthURL, bm.healthCheckTimeout)
+	bm.mu.RLock()
+	checkers := bm.healthCheckers
+	options := bm.healthOptions
+	bm.mu.RUnlock()
 
-	if isHealthy {
-		if !backend.IsAlive() {
-			log.Printf("Backend %s (ID: %s) is now healthy", backend.URL.String(), backend.InstanceID)
-			backend.SetAlive(true)
-			metrics.BackendStatusGauge.WithLabelValues(backend.URL.Host, backend.InstanceID).Set(1)
+	metadata := backend.GetMetadata()
+	// udp backends have no checker; registration counts as healthy and unreachable ports trip the circuit breaker
+	isHealthy := true
+	var checkErr error
+	if checker := checkers.For(backend.URL, metadata); checker != nil {
+		start := time.Now()
+		ctx, cancel := context.WithTimeout(context.Background(), bm.healthCheckTimeout)
+		checkErr = checker.Check(ctx, healthcheck.Target{
+			URL: backend.URL,
+			HealthPath: backend.HealthPath,
+			Metadata: metadata,
+		})
+		cancel()
+		isHealthy = checkErr == nil
+		result := "success"
+		if !isHealthy {
+			result = "failure"
 		}
+		metrics.HealthCheckDuration.WithLabelValues(backend.URL.Host, backend.InstanceID, checker.Type(), result).Observe(time.Since(start).Seconds())
+	}
+
+	consecutive, alive, changed := backend.recordHealthResult(isHealthy, options.HealthyThreshold, options.UnhealthyThreshold)
+	if checkErr != nil {
+		log.Printf("Health check for %s (ID: %s) failed (%d in a row): %v", backend.URL.String(), backend.InstanceID, consecutive, checkErr)
+	}
+	if !changed {
+		return
+	}
+	if alive {
+		log.Printf("Backend %s (ID: %s) is now healthy", backend.URL.String(), backend.InstanceID)
+		backend.SetAlive(true)
+		metrics.BackendStatusGauge.WithLabelValues(backend.URL.Host, backend.InstanceID).Set(1)
 	} else {
-		if backend.IsAlive() {
-			log.Printf("Backend %s (ID: %s) is now unhealthy", backend.URL.String(), backend.InstanceID)
-			backend.SetAlive(false)
-			metrics.BackendStatusGauge.WithLabelValues(backend.URL.Host, backend.InstanceID).Set(0)
-		}
+		log.Printf("Backend %s (ID: %s) is now unhealthy", backend.URL.String(), backend.InstanceID)
+		backend.SetAlive(false)
+		metrics.BackendStatusGauge.WithLabelValues(backend.URL.Host, backend.InstanceID).Set(0)
 	}
 }
 
+// lock- and allocation-free; the returned slice is shared and must not be modified
 func (bm *BackendManager) GetHealthyBackends() []*Backend {
-	bm.mu.RLock()
-	defer bm.mu.RUnlock()
+	return *bm.healthy.Load()
+}
 
-	healthyBackends := make([]*Backend, 0)
+// rebuilds the healthy snapshot; must not be called with mu held
+func (bm *BackendManager) publishHealthyBackends() {
+	bm.snapshotMu.Lock()
+	defer bm.snapshotMu.Unlock()
+
+	bm.mu.RLock()
+	healthyBackends := make([]*Backend, 0, len(bm.backends))
 	for _, b := range bm.backends {
-		if b.IsAlive() {
+		if b.TakesTraffic() {
 			healthyBackends = append(healthyBackends, b)
 		}
 	}
+	bm.mu.RUnlock()
+
+	bm.healthy.Store(&healthyBackends)
+}
+
+// every backend in the pool, including the ones not taking traffic
+func (bm *BackendManager) Backends() []*Backend {
+	bm.mu.RLock()
+	defer bm.mu.RUnlock()
+
+	backends := make([]*Backend, len(bm.backends))
+	copy(backends, bm.backends)
+	return backends
+}
+
+func (bm *BackendManager) FindBackend(instanceID string) *Backend {
+	return bm.findBackend(instanceID)
+}
+
+// operator-initiated drain; the instance is kept out of the pool until re-enabled, even while it is still registered
+func (bm *BackendManager) Drain(instanceID string) bool {
+	b := bm.findBackend(instanceID)
+	if b == nil {
+		return false
+	}
+	bm.mu.Lock()
+	bm.drained[instanceID] = true
+	bm.mu.Unlock()
+	bm.drainBackend(b, "requested by an operator")
+	return true
+}
+
+func (bm *BackendManager) Disable(instanceID string) bool {
+	b := bm.findBackend(instanceID)
+	if b == nil {
+		return false
+	}
+	b.SetDisabled(true)
+	return true
+}
+
+// undoes Disable and Drain; a drained instance rejoins the pool if it is still registered
+func (bm *BackendManager) Enable(instanceID string) bool {
+	bm.mu.Lock()
+	wasDrained := bm.drained[instanceID]
+	delete(bm.drained, instanceID)
+	bm.mu.Unlock()
+
+	b := bm.findBackend(instanceID)
+	if b != nil {
+		b.SetDisabled(false)
+		if wasDrained {
+			b.setDraining(false)
+		}
+	}
+	if wasDrained {
+		// re-adds it if it was already removed, or drains it again if it has been deregistered meanwhile
+		bm.discoverBackends()
+	}
+	return b != nil || wasDrained
+}
+
+// instance IDs drained by an operator
+func (bm *BackendManager) DrainedInstances() []string {
+	bm.mu.RLock()
+	defer bm.mu.RUnlock()
+
+	instanceIDs := make([]string, 0, len(bm.drained))
+	for instanceID := range bm.drained {
+		instanceIDs = append(instanceIDs, instanceID)
+	}
+	return instanceIDs
+}
 
-	return healthyBackends
+// fetches the registry right away instead of waiting for the next poll
+func (bm *BackendManager) Discover() {
+	bm.discoverBackends()
+}
+
+// probes every backend right away instead of waiting for the next tick
+func (bm *BackendManager) CheckHealth() {
+	bm.checkAllBackends(false)
+}
+
+func (bm *BackendManager) ServiceName() string {
+	return bm.serviceName
 }
 
 func (bm *BackendManager) Stop() {
 	bm.healthCheckTicker.Stop()
 	bm.discoveryTicker.Stop()
 	close(bm.stopChan)
+
+	for _, b := range bm.Backends() {
+		b.closeTransport()
+	}
+	bm.mu.RLock()
+	bm.healthTransport.CloseIdleConnections()
+	bm.healthCheckers.Close()
+	bm.mu.RUnlock()
 }
\ No newline at end of file
@@ -0,0 +1,249 @@
+package balancer
+
+import (
+	"sync"
+	"time"
+)
+
+type CircuitState int
+
+const (
+	CircuitClosed CircuitState = iota
+	CircuitOpen
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half_open"
+	default:
+		return "unknown"
+	}
+}
+
+const (
+	defaultConsecutiveFailures = 5
+	defaultErrorRateWindow     = 10 * time.Second
+	defaultOpenDuration        = 30 * time.Second
+	defaultHalfOpenRequests    = 1
+	defaultMinRequests         = 10
+	// granularity of the sliding error rate window
+	windowBuckets = 10
+)
+
+type CircuitBreakerOptions struct {
+	ConsecutiveFailures int           // trips after this many failures in a row, negative disables
+	ErrorRateThreshold  float64       // trips when the failure ratio over the window reaches this (0-1), 0 disables
+	MinRequests         int           // requests needed in the window before the error rate is considered
+	Window              time.Duration // length of the sliding error rate window
+	OpenDuration        time.Duration // time spent open before probing
+	HalfOpenRequests    int           // probe requests let through while half-open
+}
+
+func (o CircuitBreakerOptions) withDefaults() CircuitBreakerOptions {
+	if o.ConsecutiveFailures == 0 {
+		o.ConsecutiveFailures = defaultConsecutiveFailures
+	}
+	if o.MinRequests <= 0 {
+		o.MinRequests = defaultMinRequests
+	}
+	if o.Window <= 0 {
+		o.Window = defaultErrorRateWindow
+	}
+	if o.OpenDuration <= 0 {
+		o.OpenDuration = defaultOpenDuration
+	}
+	if o.HalfOpenRequests <= 0 {
+		o.HalfOpenRequests = defaultHalfOpenRequests
+	}
+	return o
+}
+
+type windowBucket struct {
+	epoch     int64 // index of the bucket-sized time slice the counts belong to
+	successes int
+	failures  int
+}
+
+// closed lets everything through, open rejects everything until OpenDuration has passed,
+// half-open lets a limited number of probes through and closes once all of them succeed
+type CircuitBreaker struct {
+	mu                  sync.Mutex
+	options             CircuitBreakerOptions
+	state               CircuitState
+	consecutiveFailures int
+	buckets             [windowBuckets]windowBucket
+	openedAt            time.Time
+	halfOpenInFlight    int
+	halfOpenSuccesses   int
+	onStateChange       func(from, to CircuitState)
+	now                 func() time.Time // replaced in tests
+}
+
+func NewCircuitBreaker(options CircuitBreakerOptions, onStateChange func(from, to CircuitState)) *CircuitBreaker {
+	return &CircuitBreaker{
+		options:       options.withDefaults(),
+		state:         CircuitClosed,
+		onStateChange: onStateChange,
+		now:           time.Now,
+	}
+}
+
+func (cb *CircuitBreaker) State() CircuitState {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return cb.currentState(cb.now())
+}
+
+// reports whether a request would be let through, without reserving a half-open probe
+func (cb *CircuitBreaker) Ready() bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	switch cb.currentState(cb.now()) {
+	case CircuitClosed:
+		return true
+	case CircuitHalfOpen:
+		return cb.halfOpenInFlight < cb.options.HalfOpenRequests
+	default:
+		return false
+	}
+}
+
+// reserves a slot for a request; every allowed request must be followed by RecordSuccess, RecordFailure or Release
+func (cb *CircuitBreaker) Allow() bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	switch cb.currentState(cb.now()) {
+	case CircuitClosed:
+		return true
+	case CircuitHalfOpen:
+		if cb.halfOpenInFlight < cb.options.HalfOpenRequests {
+			cb.halfOpenInFlight++
+			return true
+		}
+		return false
+	default:
+		return false
+	}
+}
+
+func (cb *CircuitBreaker) RecordSuccess() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	now := cb.now()
+	switch cb.currentState(now) {
+	case CircuitClosed:
+		cb.consecutiveFailures = 0
+		cb.bucket(now).successes++
+	case CircuitHalfOpen:
+		if cb.halfOpenInFlight > 0 {
+			cb.halfOpenInFlight--
+		}
+		cb.halfOpenSuccesses++
+		if cb.halfOpenSuccesses >= cb.options.HalfOpenRequests {
+			cb.transition(CircuitClosed, now)
+		}
+	}
+}
+
+// frees a half-open probe slot without counting a result, so another request can probe instead
+func (cb *CircuitBreaker) Release() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if cb.currentState(cb.now()) == CircuitHalfOpen && cb.halfOpenInFlight > 0 {
+		cb.halfOpenInFlight--
+	}
+}
+
+func (cb *CircuitBreaker) RecordFailure() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	now := cb.now()
+	switch cb.currentState(now) {
+	case CircuitClosed:
+		cb.consecutiveFailures++
+		cb.bucket(now).failures++
+		if cb.shouldTrip(now) {
+			cb.transition(CircuitOpen, now)
+		}
+	case CircuitHalfOpen:
+		// a single failed probe sends the breaker back to open
+		cb.transition(CircuitOpen, now)
+	}
+}
+
+// moves an expired open breaker to half-open; callers must hold mu
+func (cb *CircuitBreaker) currentState(now time.Time) CircuitState {
+	if cb.state == CircuitOpen && now.Sub(cb.openedAt) >= cb.options.OpenDuration {
+		cb.transition(CircuitHalfOpen, now)
+	}
+	return cb.state
+}
+
+func (cb *CircuitBreaker) shouldTrip(now time.Time) bool {
+	if cb.options.ConsecutiveFailures > 0 && cb.consecutiveFailures >= cb.options.ConsecutiveFailures {
+		return true
+	}
+	if cb.options.ErrorRateThreshold <= 0 {
+		return false
+	}
+
+	successes, failures := cb.windowCounts(now)
+	total := successes + failures
+	return total >= cb.options.MinRequests && float64(failures)/float64(total) >= cb.options.ErrorRateThreshold
+}
+
+func (cb *CircuitBreaker) transition(to CircuitState, now time.Time) {
+	from := cb.state
+	if from == to {
+		return
+	}
+
+	cb.state = to
+	cb.halfOpenInFlight = 0
+	cb.halfOpenSuccesses = 0
+	switch to {
+	case CircuitOpen:
+		cb.openedAt = now
+		// moving to half-open on time rather than on the next request, so the state change is observed
+		// by backends that are not being selected while open
+		time.AfterFunc(cb.options.OpenDuration, func() { cb.State() })
+	case CircuitClosed:
+		cb.consecutiveFailures = 0
+		cb.buckets = [windowBuckets]windowBucket{}
+	}
+
+	if cb.onStateChange != nil {
+		cb.onStateChange(from, to)
+	}
+}
+
+func (cb *CircuitBreaker) bucketDuration() time.Duration {
+	return cb.options.Window / windowBuckets
+}
+
+// the bucket for the current time slice, cleared if it still holds counts from an older slice
+func (cb *CircuitBreaker) bucket(now time.Time) *windowBucket {
+	epoch := now.UnixNano() / int64(cb.bucketDuration())
+	b := &cb.buckets[epoch%windowBuckets]
+	if b.epoch != epoch {
+		*b = windowBucket{epoch: epoch}
+	}
+	return b
+}
+
+func (cb *CircuitBreaker) windowCounts(now time.Time) (successes int, failures int) {
+	current := now.UnixNano() / int64(cb.bucketDuration())
+	for _, b := range cb.buckets {
+		if current-b.epoch < windowBuckets {
+			successes += b.successes
+			failures += b.failures
+		}
+	}
+	return successes, failures
+}
@@ -0,0 +1,132 @@
+package balancer
+
+import (
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	t time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{t: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) now() time.Time {
+	return c.t
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.t = c.t.Add(d)
+}
+
+type transition struct {
+	from CircuitState
+	to   CircuitState
+}
+
+func newTestBreaker(options CircuitBreakerOptions) (*CircuitBreaker, *fakeClock, *[]transition) {
+	clock := newFakeClock()
+	transitions := &[]transition{}
+	cb := NewCircuitBreaker(options, func(from, to CircuitState) {
+		*transitions = append(*transitions, transition{from, to})
+	})
+	cb.now = clock.now
+	return cb, clock, transitions
+}
+
+func TestCircuitBreakerTripsOnConsecutiveFailures(t *testing.T) {
+	cb, _, transitions := newTestBreaker(CircuitBreakerOptions{ConsecutiveFailures: 3})
+
+	cb.RecordFailure()
+	cb.RecordFailure()
+	cb.RecordSuccess() // resets the run
+	cb.RecordFailure()
+	cb.RecordFailure()
+	if got := cb.State(); got != CircuitClosed {
+		t.Fatalf("state after an interrupted run = %s, want closed", got)
+	}
+
+	cb.RecordFailure()
+	if got := cb.State(); got != CircuitOpen {
+		t.Fatalf("state after 3 failures in a row = %s, want open", got)
+	}
+	if cb.Allow() || cb.Ready() {
+		t.Fatal("open breaker let a request through")
+	}
+	if len(*transitions) != 1 || (*transitions)[0] != (transition{CircuitClosed, CircuitOpen}) {
+		t.Fatalf("transitions = %v, want closed to open", *transitions)
+	}
+}
+
+func TestCircuitBreakerErrorRate(t *testing.T) {
+	cb, clock, _ := newTestBreaker(CircuitBreakerOptions{
+		ConsecutiveFailures: -1,
+		ErrorRateThreshold:  0.5,
+		MinRequests:         4,
+		Window:              10 * time.Second,
+	})
+
+	// old failures slide out of the window before the error rate is reached
+	cb.RecordFailure()
+	cb.RecordFailure()
+	clock.advance(11 * time.Second)
+	cb.RecordSuccess()
+	cb.RecordSuccess()
+	cb.RecordFailure()
+	if got := cb.State(); got != CircuitClosed {
+		t.Fatalf("state below the minimum request count = %s, want closed", got)
+	}
+
+	cb.RecordFailure() // 2 of 4 in the window
+	if got := cb.State(); got != CircuitOpen {
+		t.Fatalf("state at a 50%% error rate = %s, want open", got)
+	}
+}
+
+func TestCircuitBreakerHalfOpen(t *testing.T) {
+	tests := []struct {
+		name      string
+		probe     func(cb *CircuitBreaker)
+		wantState CircuitState
+	}{
+		{"successful probe closes", (*CircuitBreaker).RecordSuccess, CircuitClosed},
+		{"failed probe reopens", (*CircuitBreaker).RecordFailure, CircuitOpen},
+		{"released probe stays half-open", (*CircuitBreaker).Release, CircuitHalfOpen},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cb, clock, _ := newTestBreaker(CircuitBreakerOptions{
+				ConsecutiveFailures: 1,
+				OpenDuration:        30 * time.Second,
+				HalfOpenRequests:    1,
+			})
+			cb.RecordFailure()
+
+			clock.advance(29 * time.Second)
+			if got := cb.State(); got != CircuitOpen {
+				t.Fatalf("state before the open duration = %s, want open", got)
+			}
+			clock.advance(time.Second)
+			if got := cb.State(); got != CircuitHalfOpen {
+				t.Fatalf("state after the open duration = %s, want half-open", got)
+			}
+
+			if !cb.Allow() {
+				t.Fatal("half-open breaker rejected its probe")
+			}
+			if cb.Allow() || cb.Ready() {
+				t.Fatal("half-open breaker let a second probe through")
+			}
+
+			tt.probe(cb)
+			if got := cb.State(); got != tt.wantState {
+				t.Fatalf("state after the probe = %s, want %s", got, tt.wantState)
+			}
+			if tt.wantState == CircuitHalfOpen && !cb.Allow() {
+				t.Fatal("released probe slot was not given back")
+			}
+		})
+	}
+}
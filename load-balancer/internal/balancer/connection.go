@@ -0,0 +1,21 @@
+package balancer
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// looks up the strategy of a service in the running configuration, which changes on reloads; nil if it is gone
+type StrategyResolver func(service string) LoadBalancingStrategy
+
+// stands in for the HTTP request strategies select by when balancing raw TCP connections or UDP sessions;
+// only the client address is meaningful, so consistent hashing of layer 4 services is limited to ip keys
+func ConnectionRequest(remoteAddr string) *http.Request {
+	return (&http.Request{
+		Method:     http.MethodConnect,
+		URL:        &url.URL{Path: "/"},
+		Header:     make(http.Header),
+		RemoteAddr: remoteAddr,
+	}).WithContext(context.Background())
+}
@@ -0,0 +1,233 @@
+package balancer
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/lokeshllkumar/load-balancer/internal/forwarded"
+)
+
+const (
+	defaultVirtualNodes = 160
+	defaultHashKey      = "ip"
+)
+
+type ConsistentHashOptions struct {
+	Key          string  // ip, header, cookie or path
+	KeyName      string  // header or cookie name
+	PathSegment  int     // 1-based index of the path segment to hash
+	VirtualNodes int     // ring points per backend
+	LoadFactor   float64 // max connections relative to the average, 0 disables bounded loads
+}
+
+// points on the ring are derived only from instance IDs, so adding or removing a
+// backend only moves the keys that land next to its own points
+type hashRing struct {
+	points   []uint64 // sorted
+	owners   []int    // index into backends of each point's owner
+	backends []*Backend
+	members  map[string]*Backend
+}
+
+func newHashRing(backends []*Backend, virtualNodes int) *hashRing {
+	ring := &hashRing{
+		points:  make([]uint64, 0, len(backends)*virtualNodes),
+		members: make(map[string]*Backend, len(backends)),
+	}
+	owners := make(map[uint64]*Backend, len(backends)*virtualNodes)
+	for _, b := range backends {
+		ring.members[b.InstanceID] = b
+		for i := 0; i < virtualNodes; i++ {
+			point := xxhash.Sum64String(b.InstanceID + "#" + strconv.Itoa(i))
+			if _, taken := owners[point]; taken {
+				continue
+			}
+			owners[point] = b
+			ring.points = append(ring.points, point)
+		}
+	}
+	sort.Slice(ring.points, func(i, j int) bool { return ring.points[i] < ring.points[j] })
+
+	ring.owners = make([]int, len(ring.points))
+	indexes := make(map[*Backend]int, len(backends))
+	for i, point := range ring.points {
+		owner := owners[point]
+		index, ok := indexes[owner]
+		if !ok {
+			index = len(ring.backends)
+			indexes[owner] = index
+			ring.backends = append(ring.backends, owner)
+		}
+		ring.owners[i] = index
+	}
+	return ring
+}
+
+func (r *hashRing) sameMembers(backends []*Backend) bool {
+	if len(backends) != len(r.members) {
+		return false
+	}
+	for _, b := range backends {
+		if r.members[b.InstanceID] != b {
+			return false
+		}
+	}
+	return true
+}
+
+// walks clockwise from the key, skipping backends at or above the capacity and those already tried
+func (r *hashRing) lookup(req *http.Request, key string, capacity int32) *Backend {
+	if len(r.points) == 0 {
+		return nil
+	}
+
+	hash := xxhash.Sum64String(key)
+	start := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= hash })
+
+	// a bit per backend, kept on the stack for rings of up to 256 backends
+	var visitedBits [4]uint64
+	visited := visitedBits[:]
+	if words := (len(r.backends) + 63) / 64; words > len(visited) {
+		visited = make([]uint64, words)
+	}
+
+	var first *Backend
+	for i, tried := 0, 0; i < len(r.points) && tried < len(r.backends); i++ {
+		index := r.owners[(start+i)%len(r.points)]
+		if visited[index/64]&(1<<(index%64)) != 0 {
+			continue
+		}
+		visited[index/64] |= 1 << (index % 64)
+		tried++
+		owner := r.backends[index]
+		if isExcluded(req, owner) {
+			continue
+		}
+		if first == nil {
+			first = owner
+		}
+		if capacity <= 0 || owner.GetConnections() < capacity {
+			return owner
+		}
+	}
+	return first
+}
+
+// Consistent Hashing with bounded loads
+type StrategyConsistentHash struct {
+	ring     *hashRing
+	mu       sync.RWMutex
+	options  ConsistentHashOptions
+	provider BackendProvider
+}
+
+func NewConsistentHashStrategy(provider BackendProvider, options ConsistentHashOptions) *StrategyConsistentHash {
+	if options.VirtualNodes <= 0 {
+		options.VirtualNodes = defaultVirtualNodes
+	}
+	if options.Key == "" {
+		options.Key = defaultHashKey
+	}
+	return &StrategyConsistentHash{
+		ring:     newHashRing(nil, options.VirtualNodes),
+		options:  options,
+		provider: provider,
+	}
+}
+
+func (ch *StrategyConsistentHash) SelectBackend(req *http.Request) *Backend {
+	backends := ch.provider.GetHealthyBackends()
+	if len(backends) == 0 {
+		return nil
+	}
+
+	ring := ch.currentRing(backends)
+
+	var capacity int32
+	if ch.options.LoadFactor > 0 {
+		var totalConnections int32
+		for _, b := range backends {
+			totalConnections += b.GetConnections()
+		}
+		// counting the request being placed so an idle pool never has a capacity of zero
+		average := float64(totalConnections+1) / float64(len(backends))
+		capacity = int32(math.Ceil(average * ch.options.LoadFactor))
+	}
+
+	key := ch.hashKey(req)
+	selected := ring.lookup(req, key, capacity)
+	if selected != nil {
+		log.Printf("Consistent Hash selected backend: %s for key %q", selected.URL.String(), key)
+	}
+	return selected
+}
+
+// the ring is only rebuilt when the set of healthy backends changes
+func (ch *StrategyConsistentHash) currentRing(backends []*Backend) *hashRing {
+	ch.mu.RLock()
+	ring := ch.ring
+	ch.mu.RUnlock()
+	if ring.sameMembers(backends) {
+		return ring
+	}
+
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	if !ch.ring.sameMembers(backends) {
+		ch.ring = newHashRing(backends, ch.options.VirtualNodes)
+		log.Printf("Consistent Hash: ring rebuilt with %d backends", len(backends))
+	}
+	return ch.ring
+}
+
+// falls back to the client IP when the configured attribute is missing from the request
+func (ch *StrategyConsistentHash) hashKey(req *http.Request) string {
+	switch ch.options.Key {
+	case "header":
+		if value := req.Header.Get(ch.options.KeyName); value != "" {
+			return value
+		}
+	case "cookie":
+		if cookie, err := req.Cookie(ch.options.KeyName); err == nil && cookie.Value != "" {
+			return cookie.Value
+		}
+	case "path":
+		segments := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+		// an empty segment, as in "/" or "/a//b", would send every such request to one backend
+		if ch.options.PathSegment > 0 && ch.options.PathSegment <= len(segments) && segments[ch.options.PathSegment-1] != "" {
+			return segments[ch.options.PathSegment-1]
+		}
+	}
+
+	return forwarded.ClientIP(req)
+}
+
+func (ch *StrategyConsistentHash) AddBackend(backend *Backend) {}
+
+func (ch *StrategyConsistentHash) RemoveBackend(backend *Backend) {}
+
+func (ch *StrategyConsistentHash) State() any {
+	ch.mu.RLock()
+	ring := ch.ring
+	ch.mu.RUnlock()
+
+	members := make([]string, 0, len(ring.members))
+	for id := range ring.members {
+		members = append(members, id)
+	}
+	sort.Strings(members)
+	return map[string]any{
+		"key":          ch.options.Key,
+		"keyName":      ch.options.KeyName,
+		"virtualNodes": ch.options.VirtualNodes,
+		"loadFactor":   ch.options.LoadFactor,
+		"ringPoints":   len(ring.points),
+		"members":      members,
+	}
+}
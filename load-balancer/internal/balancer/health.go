@@ -0,0 +1,73 @@
+package balancer
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/lokeshllkumar/load-balancer/internal/healthcheck"
+)
+
+const (
+	defaultMaxConcurrentProbes = 16
+	// unset jitter spreads each round's probes over this share of the interval
+	defaultJitterFraction = 10
+)
+
+// how a pool's backends are probed and how many results it takes to change their state
+type HealthCheckOptions struct {
+	Check               healthcheck.Options
+	HealthyThreshold    int           // consecutive successes before an unhealthy backend takes traffic again, defaults to 1
+	UnhealthyThreshold  int           // consecutive failures before a healthy backend is taken out, defaults to 1
+	Jitter              time.Duration // each probe starts after a random delay up to this; 0 uses a tenth of the interval, negative disables
+	MaxConcurrentProbes int           // probes in flight at once per pool, defaults to 16
+}
+
+func (options HealthCheckOptions) withDefaults(interval time.Duration) HealthCheckOptions {
+	if options.HealthyThreshold < 1 {
+		options.HealthyThreshold = 1
+	}
+	if options.UnhealthyThreshold < 1 {
+		options.UnhealthyThreshold = 1
+	}
+	if options.Jitter == 0 {
+		options.Jitter = interval / defaultJitterFraction
+	}
+	if options.MaxConcurrentProbes < 1 {
+		options.MaxConcurrentProbes = defaultMaxConcurrentProbes
+	}
+	return options
+}
+
+// probes reuse a single idle connection per backend instead of dialing every time,
+// without taking connections from the pool that carries traffic
+func newHealthTransport(options TransportOptions) *http.Transport {
+	options.MaxIdleConnsPerHost = 1
+	return newTransport(options)
+}
+
+// counts consecutive results and reports whether the backend's state should change (HAProxy-style rise/fall);
+// the first result for a backend applies right away so a new pool can take traffic after one round
+func (b *Backend) recordHealthResult(healthy bool, rise int, fall int) (consecutive int, alive bool, changed bool) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	first := !b.healthChecked
+	b.healthChecked = true
+	if healthy {
+		b.healthFailures = 0
+		b.healthSuccesses++
+		consecutive = b.healthSuccesses
+	} else {
+		b.healthSuccesses = 0
+		b.healthFailures++
+		consecutive = b.healthFailures
+	}
+
+	switch {
+	case healthy == b.Alive:
+		return consecutive, b.Alive, false
+	case first, healthy && consecutive >= rise, !healthy && consecutive >= fall:
+		return consecutive, healthy, true
+	}
+	return consecutive, b.Alive, false
+}
@@ -0,0 +1,277 @@
+package balancer
+
+import (
+	"context"
+	"log"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/lokeshllkumar/load-balancer/internal/metrics"
+)
+
+const (
+	defaultConsecutive5xx            = 5
+	defaultConsecutiveGatewayFailure = 3
+	defaultOutlierInterval           = 10 * time.Second
+	defaultBaseEjectionTime          = 30 * time.Second
+	defaultMaxEjectionTime           = 300 * time.Second
+	defaultMaxEjectionPercent        = 10
+	defaultSuccessRateMinimumHosts   = 5
+	defaultSuccessRateRequestVolume  = 100
+	defaultSuccessRateStdevFactor    = 1.9
+)
+
+// Envoy-style passive outlier detection, fed by the results of live traffic; zero values fall back to the defaults above
+type OutlierDetectionOptions struct {
+	Consecutive5xx            int           // ejects after this many 5xx responses or failed requests in a row, negative disables
+	ConsecutiveGatewayFailure int           // the same for 502, 503, 504 and failed requests only, negative disables
+	Interval                  time.Duration // how often success rates are compared and ejections expire
+	BaseEjectionTime          time.Duration // multiplied by the number of times the backend has been ejected
+	MaxEjectionTime           time.Duration
+	MaxEjectionPercent        int           // share of the pool that may be ejected at once; at least one backend, never all of them
+	SuccessRateMinimumHosts   int           // backends with enough requests needed before success rates are compared, negative disables
+	SuccessRateRequestVolume  int           // requests a backend needs in an interval to take part
+	SuccessRateStdevFactor    float64       // ejects backends whose success rate is this many standard deviations below the mean
+	SlowResponseThreshold     time.Duration // slower responses count as failures towards the success rate, 0 disables
+}
+
+func (o OutlierDetectionOptions) withDefaults() OutlierDetectionOptions {
+	if o.Consecutive5xx == 0 {
+		o.Consecutive5xx = defaultConsecutive5xx
+	}
+	if o.ConsecutiveGatewayFailure == 0 {
+		o.ConsecutiveGatewayFailure = defaultConsecutiveGatewayFailure
+	}
+	if o.Interval <= 0 {
+		o.Interval = defaultOutlierInterval
+	}
+	if o.BaseEjectionTime <= 0 {
+		o.BaseEjectionTime = defaultBaseEjectionTime
+	}
+	if o.MaxEjectionTime <= 0 {
+		o.MaxEjectionTime = defaultMaxEjectionTime
+	}
+	if o.MaxEjectionTime < o.BaseEjectionTime {
+		o.MaxEjectionTime = o.BaseEjectionTime
+	}
+	if o.MaxEjectionPercent <= 0 {
+		o.MaxEjectionPercent = defaultMaxEjectionPercent
+	}
+	if o.SuccessRateMinimumHosts == 0 {
+		o.SuccessRateMinimumHosts = defaultSuccessRateMinimumHosts
+	}
+	if o.SuccessRateRequestVolume <= 0 {
+		o.SuccessRateRequestVolume = defaultSuccessRateRequestVolume
+	}
+	if o.SuccessRateStdevFactor <= 0 {
+		o.SuccessRateStdevFactor = defaultSuccessRateStdevFactor
+	}
+	return o
+}
+
+// a backend's traffic results and ejection history, guarded by the backend's mux
+type outlierState struct {
+	consecutive5xx     int
+	consecutiveGateway int
+	successes          int // in the current interval
+	failures           int
+	ejected            bool
+	ejectedUntil       time.Time
+	ejections          int // grows with every ejection and shrinks with every interval spent in the pool
+}
+
+// ejects backends of one pool that fail more than the rest, so they stop taking traffic for a while
+type OutlierDetector struct {
+	options  OutlierDetectionOptions
+	backends func() []*Backend
+	mu       sync.Mutex // serializes ejections, so the maximum ejection percentage holds
+}
+
+func NewOutlierDetector(options OutlierDetectionOptions, backends func() []*Backend) *OutlierDetector {
+	return &OutlierDetector{
+		options:  options.withDefaults(),
+		backends: backends,
+	}
+}
+
+// status 0 stands for a request that got no response at all
+func isGatewayFailure(status int) bool {
+	return status == 0 || status == http.StatusBadGateway || status == http.StatusServiceUnavailable || status == http.StatusGatewayTimeout
+}
+
+// called by the proxy for every response
+func (d *OutlierDetector) record(b *Backend, status int, latency time.Duration) {
+	serverError := status == 0 || status >= http.StatusInternalServerError
+	gatewayFailure := isGatewayFailure(status)
+	slow := d.options.SlowResponseThreshold > 0 && latency > d.options.SlowResponseThreshold
+
+	b.mux.Lock()
+	state := &b.outlier
+	if serverError || slow {
+		state.failures++
+	} else {
+		state.successes++
+	}
+	if serverError {
+		state.consecutive5xx++
+	} else {
+		state.consecutive5xx = 0
+	}
+	if gatewayFailure {
+		state.consecutiveGateway++
+	} else {
+		state.consecutiveGateway = 0
+	}
+	reason := ""
+	switch {
+	case state.ejected:
+	case d.options.ConsecutiveGatewayFailure > 0 && state.consecutiveGateway >= d.options.ConsecutiveGatewayFailure:
+		reason = "consecutive_gateway_failure"
+	case d.options.Consecutive5xx > 0 && state.consecutive5xx >= d.options.Consecutive5xx:
+		reason = "consecutive_5xx"
+	}
+	b.mux.Unlock()
+
+	if reason != "" {
+		d.eject(b, reason)
+	}
+}
+
+// reports whether the backend was ejected; refused once the pool's maximum ejection percentage is reached
+func (d *OutlierDetector) eject(b *Backend, reason string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	backends := d.backends()
+	ejected := 0
+	for _, other := range backends {
+		if other.IsEjected() {
+			ejected++
+		}
+	}
+	maxEjected := len(backends) * d.options.MaxEjectionPercent / 100
+	if maxEjected < 1 {
+		maxEjected = 1
+	}
+	if maxEjected > len(backends)-1 {
+		maxEjected = len(backends) - 1
+	}
+	if ejected >= maxEjected {
+		// counting starts over, so a refused backend is not reconsidered on every response
+		b.mux.Lock()
+		b.outlier.consecutive5xx = 0
+		b.outlier.consecutiveGateway = 0
+		b.mux.Unlock()
+		log.Printf("Outlier detection: not ejecting backend %s (ID: %s) for %s, %d of %d backend(s) already ejected", b.URL.String(), b.InstanceID, reason, ejected, len(backends))
+		return false
+	}
+
+	b.mux.Lock()
+	if b.outlier.ejected {
+		b.mux.Unlock()
+		return false
+	}
+	b.outlier.ejections++
+	ejectionTime := time.Duration(b.outlier.ejections) * d.options.BaseEjectionTime
+	if ejectionTime > d.options.MaxEjectionTime {
+		ejectionTime = d.options.MaxEjectionTime
+	}
+	b.outlier.ejected = true
+	b.outlier.ejectedUntil = time.Now().Add(ejectionTime)
+	b.outlier.consecutive5xx = 0
+	b.outlier.consecutiveGateway = 0
+	b.mux.Unlock()
+
+	log.Printf("Outlier detection: ejected backend %s (ID: %s) for %v (%s)", b.URL.String(), b.InstanceID, ejectionTime, reason)
+	metrics.OutlierEjectionsTotal.WithLabelValues(b.URL.Host, b.InstanceID, reason).Inc()
+	metrics.OutlierEjectedGauge.WithLabelValues(b.URL.Host, b.InstanceID).Set(1)
+	b.availabilityChanged()
+	return true
+}
+
+// returns backends whose ejection has run out, then compares success rates over the interval that just ended
+func (d *OutlierDetector) sweep() {
+	now := time.Now()
+	type sample struct {
+		backend *Backend
+		rate    float64
+	}
+	var samples []sample
+	for _, b := range d.backends() {
+		b.mux.Lock()
+		state := &b.outlier
+		returned := false
+		switch {
+		case state.ejected && !now.Before(state.ejectedUntil):
+			state.ejected = false
+			returned = true
+		case !state.ejected && state.ejections > 0:
+			state.ejections--
+		}
+		requests := state.successes + state.failures
+		if !state.ejected && requests >= d.options.SuccessRateRequestVolume {
+			samples = append(samples, sample{backend: b, rate: float64(state.successes) / float64(requests)})
+		}
+		state.successes = 0
+		state.failures = 0
+		b.mux.Unlock()
+
+		if returned {
+			log.Printf("Outlier detection: backend %s (ID: %s) returned to the pool", b.URL.String(), b.InstanceID)
+			metrics.OutlierEjectedGauge.WithLabelValues(b.URL.Host, b.InstanceID).Set(0)
+			b.availabilityChanged()
+		}
+	}
+
+	if d.options.SuccessRateMinimumHosts < 0 || len(samples) < d.options.SuccessRateMinimumHosts || len(samples) == 0 {
+		return
+	}
+	var sum float64
+	for _, s := range samples {
+		sum += s.rate
+	}
+	mean := sum / float64(len(samples))
+	var variance float64
+	for _, s := range samples {
+		variance += (s.rate - mean) * (s.rate - mean)
+	}
+	stdev := math.Sqrt(variance / float64(len(samples)))
+	threshold := mean - d.options.SuccessRateStdevFactor*stdev
+	for _, s := range samples {
+		if s.rate < threshold {
+			log.Printf("Outlier detection: backend %s (ID: %s) success rate %.3f is below the pool's threshold %.3f", s.backend.URL.String(), s.backend.InstanceID, s.rate, threshold)
+			d.eject(s.backend, "success_rate")
+		}
+	}
+}
+
+func (d *OutlierDetector) Run(ctx context.Context, stop <-chan struct{}) {
+	ticker := time.NewTicker(d.options.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			d.sweep()
+		case <-stop:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// feeds a proxied response into outlier detection; status 0 stands for a request that got no response,
+// so attempts cancelled by the client must not be fed in
+func (b *Backend) RecordResponse(status int, latency time.Duration) {
+	if b.outlierDetector != nil {
+		b.outlierDetector.record(b, status, latency)
+	}
+}
+
+func (b *Backend) IsEjected() bool {
+	b.mux.RLock()
+	defer b.mux.RUnlock()
+	return b.outlier.ejected
+}
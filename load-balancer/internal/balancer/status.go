@@ -0,0 +1,54 @@
+package balancer
+
+import "time"
+
+// point-in-time view of a backend for the admin API
+type BackendStatus struct {
+	InstanceID    string     `json:"instanceId"`
+	URL           string     `json:"url"`
+	HealthPath    string     `json:"healthPath"`
+	Alive         bool       `json:"alive"`
+	Available     bool       `json:"available"` // would be considered for new requests
+	Disabled      bool       `json:"disabled"`
+	Draining      bool       `json:"draining"`
+	Connections   int32      `json:"connections"`
+	LongLived     int32      `json:"longLivedConnections"`
+	ErrorCount    int        `json:"errorCount"`
+	LastError     *time.Time `json:"lastError,omitempty"`
+	CircuitState  string     `json:"circuitState"`
+	Ejected       bool       `json:"ejected"` // by outlier detection
+	Weight        int        `json:"weight"`
+	LatencyEWMAMs float64    `json:"latencyEwmaMs"`
+}
+
+func (b *Backend) Status() BackendStatus {
+	b.mux.RLock()
+	status := BackendStatus{
+		InstanceID: b.InstanceID,
+		URL:        b.URL.String(),
+		HealthPath: b.HealthPath,
+		Alive:      b.Alive,
+		Disabled:   b.disabled,
+		Draining:   b.draining,
+		ErrorCount: b.ErrorCount,
+		Ejected:    b.outlier.ejected,
+	}
+	if !b.LastError.IsZero() {
+		lastError := b.LastError
+		status.LastError = &lastError
+	}
+	b.mux.RUnlock()
+
+	status.Connections = b.GetConnections()
+	status.LongLived = b.GetLongLivedConnections()
+	status.Available = b.IsAvailable()
+	status.CircuitState = b.CircuitState().String()
+	status.Weight = b.GetWeight()
+	status.LatencyEWMAMs = float64(b.GetLatencyEWMA()) / float64(time.Millisecond)
+	return status
+}
+
+// implemented by strategies that keep state worth inspecting, such as session mappings
+type StateReporter interface {
+	State() any
+}
@@ -0,0 +1,209 @@
+package balancer
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lokeshllkumar/load-balancer/internal/sessionstore"
+)
+
+const (
+	defaultStickyCookieName = "SESSIONID"
+	defaultStickyTTL        = 24 * time.Hour
+)
+
+type StickySessionOptions struct {
+	CookieName string
+	TTL        time.Duration
+	Secret     []byte // HMAC key shared by every replica; nil uses a key generated for this process
+	Path       string
+	Domain     string
+	Secure     bool
+	HTTPOnly   bool
+	SameSite   http.SameSite
+	Store      sessionstore.Store // when set the cookie carries a session ID mapped to the backend here, shared with other replicas
+	Namespace  string             // prefixes session IDs in a store shared by several services
+}
+
+var (
+	processSecretOnce sync.Once
+	processSecret     []byte
+)
+
+// generated once so affinity survives config reloads, though not restarts or other replicas
+func generatedSecret() []byte {
+	processSecretOnce.Do(func() {
+		processSecret = make([]byte, 32)
+		if _, err := rand.Read(processSecret); err != nil {
+			panic(err)
+		}
+		log.Println("Sticky Session: no secret configured, using a generated one; cookies will not survive a restart or work across replicas")
+	})
+	return processSecret
+}
+
+// pins clients to a backend with a signed cookie naming its instance ID, so no session state is kept,
+// or with a signed session ID looked up in the session store when one is configured;
+// clients without a valid cookie, or whose backend is gone, are placed by consistent hashing
+type StrategyStickySessions struct {
+	options  StickySessionOptions
+	provider BackendProvider
+	fallback *StrategyConsistentHash
+}
+
+func NewStickySessionsStrategy(provider BackendProvider, options StickySessionOptions, fallback ConsistentHashOptions) *StrategyStickySessions {
+	if options.CookieName == "" {
+		options.CookieName = defaultStickyCookieName
+	}
+	if options.TTL <= 0 {
+		options.TTL = defaultStickyTTL
+	}
+	if options.Path == "" {
+		options.Path = "/"
+	}
+	if len(options.Secret) == 0 {
+		options.Secret = generatedSecret()
+	}
+	return &StrategyStickySessions{
+		options:  options,
+		provider: provider,
+		fallback: NewConsistentHashStrategy(provider, fallback),
+	}
+}
+
+func (ss *StrategyStickySessions) SelectBackend(req *http.Request) *Backend {
+	subject, _, valid := ss.readCookie(req)
+	instanceID := subject
+	if valid && ss.options.Store != nil {
+		instanceID, valid = ss.options.Store.Get(ss.storeKey(subject))
+		if !valid {
+			log.Printf("Sticky Session: Session %s not found in the session store, re-selecting", subject)
+		}
+	}
+	if valid {
+		for _, b := range candidateBackends(req, ss.provider) {
+			if b.InstanceID == instanceID {
+				log.Printf("Sticky Session: Reusing backend %s (ID: %s)", b.URL.String(), b.InstanceID)
+				return b
+			}
+		}
+		log.Printf("Sticky Session: Backend %s is no longer available, re-selecting", instanceID)
+	}
+
+	backend := ss.fallback.SelectBackend(req)
+	if backend != nil {
+		log.Printf("Sticky Session: Pinned client to backend %s (ID: %s)", backend.URL.String(), backend.InstanceID)
+	}
+	return backend
+}
+
+// the instance the client's cookie pins it to, through the session store when one is configured
+func (ss *StrategyStickySessions) pinnedInstance(req *http.Request) (string, time.Time, bool) {
+	subject, expires, valid := ss.readCookie(req)
+	if !valid || ss.options.Store == nil {
+		return subject, expires, valid
+	}
+	instanceID, found := ss.options.Store.Get(ss.storeKey(subject))
+	return instanceID, expires, found
+}
+
+// records the assignment and returns the cookie to (re)issue, nil while the client's own cookie already pins it
+// to backend with more than half of its TTL left (sliding expiry); with a store the client keeps its session ID if it had one
+func (ss *StrategyStickySessions) AffinityCookie(req *http.Request, backend *Backend) *http.Cookie {
+	instanceID, expires, valid := ss.pinnedInstance(req)
+	if valid && instanceID == backend.InstanceID && time.Until(expires) >= ss.options.TTL/2 {
+		return nil
+	}
+
+	if ss.options.Store == nil {
+		return ss.newCookie(backend.InstanceID)
+	}
+	sessionID, _, _ := ss.readCookie(req)
+	if sessionID == "" {
+		sessionID = newSessionID()
+	}
+	ss.options.Store.Put(ss.storeKey(sessionID), backend.InstanceID, ss.options.TTL)
+	return ss.newCookie(sessionID)
+}
+
+func (ss *StrategyStickySessions) storeKey(sessionID string) string {
+	return ss.options.Namespace + "/" + sessionID
+}
+
+func newSessionID() string {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(id)
+}
+
+// the instance ID, or session ID with a store, from a cookie that is correctly signed and not yet expired
+func (ss *StrategyStickySessions) readCookie(req *http.Request) (string, time.Time, bool) {
+	cookie, err := req.Cookie(ss.options.CookieName)
+	if err != nil {
+		return "", time.Time{}, false
+	}
+	parts := strings.Split(cookie.Value, ".")
+	if len(parts) != 3 {
+		return "", time.Time{}, false
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(signature, ss.sign(parts[0]+"."+parts[1])) {
+		return "", time.Time{}, false
+	}
+	expiresUnix, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || time.Now().Unix() >= expiresUnix {
+		return "", time.Time{}, false
+	}
+	subject, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", time.Time{}, false
+	}
+	return string(subject), time.Unix(expiresUnix, 0), true
+}
+
+func (ss *StrategyStickySessions) sign(payload string) []byte {
+	mac := hmac.New(sha256.New, ss.options.Secret)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+func (ss *StrategyStickySessions) newCookie(subject string) *http.Cookie {
+	expires := time.Now().Add(ss.options.TTL)
+	payload := base64.RawURLEncoding.EncodeToString([]byte(subject)) + "." + strconv.FormatInt(expires.Unix(), 10)
+	return &http.Cookie{
+		Name:     ss.options.CookieName,
+		Value:    payload + "." + base64.RawURLEncoding.EncodeToString(ss.sign(payload)),
+		Path:     ss.options.Path,
+		Domain:   ss.options.Domain,
+		Expires:  expires,
+		MaxAge:   int(ss.options.TTL / time.Second),
+		Secure:   ss.options.Secure,
+		HttpOnly: ss.options.HTTPOnly,
+		SameSite: ss.options.SameSite,
+	}
+}
+
+func (ss *StrategyStickySessions) AddBackend(backend *Backend) {}
+
+func (ss *StrategyStickySessions) RemoveBackend(backend *Backend) {}
+
+// sessions live in the clients' cookies or the shared store, so only the settings and the fallback ring are shown
+func (ss *StrategyStickySessions) State() any {
+	return map[string]any{
+		"cookieName":   ss.options.CookieName,
+		"ttl":          ss.options.TTL.String(),
+		"sessionStore": ss.options.Store != nil,
+		"fallback":     ss.fallback.State(),
+	}
+}
@@ -1,11 +1,13 @@
 package balancer
 
 import (
+	"context"
+	"fmt"
 	"log"
+	"math/rand/v2"
 	"net/http"
 	"sync"
 	"sync/atomic"
-	"time"
 )
 
 type LoadBalancingStrategy interface {
@@ -14,10 +16,81 @@ type LoadBalancingStrategy interface {
 	RemoveBackend(backend *Backend)
 }
 
+// strategies that keep a client on the backend picked for it with a cookie, which the proxy sets on the response
+type AffinityStrategy interface {
+	AffinityCookie(req *http.Request, backend *Backend) *http.Cookie
+}
+
 type BackendProvider interface {
 	GetHealthyBackends() []*Backend
 }
 
+// unexported, so no other package can collide with it
+type excludedBackendsKey struct{}
+
+// instance IDs already tried for the request, nil when it is not being retried
+func excludedBackends(ctx context.Context) map[string]bool {
+	excluded, _ := ctx.Value(excludedBackendsKey{}).(map[string]bool)
+	return excluded
+}
+
+// marks a backend as already tried for the request, so strategies pick a different one on retries
+func WithExcludedBackend(ctx context.Context, backend *Backend) context.Context {
+	previous := excludedBackends(ctx)
+	excluded := make(map[string]bool, len(previous)+1)
+	for id := range previous {
+		excluded[id] = true
+	}
+	excluded[backend.InstanceID] = true
+	return context.WithValue(ctx, excludedBackendsKey{}, excluded)
+}
+
+func isExcluded(req *http.Request, backend *Backend) bool {
+	return excludedBackends(req.Context())[backend.InstanceID]
+}
+
+// the healthy backends that have not been tried for the request yet
+func candidateBackends(req *http.Request, provider BackendProvider) []*Backend {
+	backends := provider.GetHealthyBackends()
+	if excludedBackends(req.Context()) == nil {
+		return backends
+	}
+
+	candidates := make([]*Backend, 0, len(backends))
+	for _, b := range backends {
+		if !isExcluded(req, b) {
+			candidates = append(candidates, b)
+		}
+	}
+	return candidates
+}
+
+// settings for the strategies that take any
+type StrategyOptions struct {
+	ConsistentHash ConsistentHashOptions
+	StickySessions StickySessionOptions // also uses ConsistentHash for clients without a session
+}
+
+// builds the strategy named in config.yaml on top of the given provider
+func NewStrategy(name string, provider BackendProvider, options StrategyOptions) (LoadBalancingStrategy, error) {
+	switch name {
+	case "round_robin":
+		return NewRoundRobinStrategy(provider), nil
+	case "weighted_round_robin":
+		return NewWeightedRoundRobinStrategy(provider), nil
+	case "least_connections":
+		return NewLeastConnectionsStrategy(provider), nil
+	case "sticky_sessions":
+		return NewStickySessionsStrategy(provider, options.StickySessions, options.ConsistentHash), nil
+	case "p2c_peak_ewma":
+		return NewP2CPeakEWMAStrategy(provider), nil
+	case "consistent_hash":
+		return NewConsistentHashStrategy(provider, options.ConsistentHash), nil
+	default:
+		return nil, fmt.Errorf("unsupported load balancing strategy: %s", name)
+	}
+}
+
 // Round Robin
 type StrategyRoundRobin struct {
 	backends []*Backend
@@ -32,7 +105,7 @@ func NewRoundRobinStrategy(provider BackendProvider) *StrategyRoundRobin {
 }
 
 func (rr *StrategyRoundRobin) SelectBackend(req *http.Request) *Backend {
-	backends := rr.provider.GetHealthyBackends()
+	backends := candidateBackends(req, rr.provider)
 	if len(backends) == 0 {
 		return nil
 	}
@@ -48,6 +121,95 @@ func (rr *StrategyRoundRobin) AddBackend(backend *Backend) {}
 
 func (rr *StrategyRoundRobin) RemoveBackend(backend *Backend) {}
 
+func (rr *StrategyRoundRobin) State() any {
+	return map[string]any{
+		"next": atomic.LoadUint64(&rr.current),
+	}
+}
+
+// Weighted Round Robin (smooth, as in nginx)
+type StrategyWeightedRoundRobin struct {
+	currentWeights map[string]int // by instance ID
+	snapshot []*Backend // the healthy backends currentWeights was built for
+	mu sync.Mutex
+	provider BackendProvider
+}
+
+func NewWeightedRoundRobinStrategy(provider BackendProvider) *StrategyWeightedRoundRobin {
+	return &StrategyWeightedRoundRobin{
+		currentWeights: make(map[string]int),
+		provider: provider,
+	}
+}
+
+func (wrr *StrategyWeightedRoundRobin) SelectBackend(req *http.Request) *Backend {
+	backends := wrr.provider.GetHealthyBackends()
+	if len(backends) == 0 {
+		return nil
+	}
+
+	wrr.mu.Lock()
+	defer wrr.mu.Unlock()
+
+	// the healthy snapshot is immutable and republished on every change, so a new one
+	// drops the state of backends that left it and they rejoin from zero
+	if !sameSnapshot(wrr.snapshot, backends) {
+		rebuilt := make(map[string]int, len(backends))
+		for _, b := range backends {
+			rebuilt[b.InstanceID] = wrr.currentWeights[b.InstanceID]
+		}
+		wrr.currentWeights = rebuilt
+		wrr.snapshot = backends
+	}
+
+	// every backend gains its weight, the leader is picked and pays back the total
+	var selected *Backend
+	totalWeight := 0
+	for _, b := range backends {
+		if isExcluded(req, b) {
+			continue
+		}
+		weight := b.GetWeight()
+		totalWeight += weight
+		wrr.currentWeights[b.InstanceID] += weight
+		if selected == nil || wrr.currentWeights[b.InstanceID] > wrr.currentWeights[selected.InstanceID] {
+			selected = b
+		}
+	}
+	if selected == nil {
+		return nil
+	}
+	wrr.currentWeights[selected.InstanceID] -= totalWeight
+
+	log.Printf("Weighted Round Robin selected backend: %s (weight: %d)", selected.URL.String(), selected.GetWeight())
+	return selected
+}
+
+func sameSnapshot(a []*Backend, b []*Backend) bool {
+	return len(a) == len(b) && (len(a) == 0 || &a[0] == &b[0])
+}
+
+func (wrr *StrategyWeightedRoundRobin) AddBackend(backend *Backend) {}
+
+func (wrr *StrategyWeightedRoundRobin) RemoveBackend(backend *Backend) {
+	wrr.mu.Lock()
+	delete(wrr.currentWeights, backend.InstanceID)
+	wrr.mu.Unlock()
+}
+
+func (wrr *StrategyWeightedRoundRobin) State() any {
+	wrr.mu.Lock()
+	defer wrr.mu.Unlock()
+
+	currentWeights := make(map[string]int, len(wrr.currentWeights))
+	for id, weight := range wrr.currentWeights {
+		currentWeights[id] = weight
+	}
+	return map[string]any{
+		"currentWeights": currentWeights,
+	}
+}
+
 // Least Connections
 type StrategyLeastConnections struct {
 	provider BackendProvider
@@ -60,7 +222,7 @@ func NewLeastConnectionsStrategy(provider BackendProvider) *StrategyLeastConnect
 }
 
 func (lc *StrategyLeastConnections) SelectBackend(req *http.Request) *Backend {
-	backends := lc.provider.GetHealthyBackends()
+	backends := candidateBackends(req, lc.provider)
 	if len(backends) == 0 {
 		return nil
 	}
@@ -85,82 +247,58 @@ func (lc *StrategyLeastConnections) AddBackend(backend *Backend) {}
 
 func (lc *StrategyLeastConnections) RemoveBackend(backend *Backend) {}
 
-// Sticky Sessions
-
-type StrategyStickySessions struct {
-	sessionMap map[string]*Backend
-	mu sync.RWMutex
+// Power of Two Choices with peak EWMA latency
+type StrategyP2CPeakEWMA struct {
 	provider BackendProvider
 }
 
-func NewStickySessionsStrategy(provider BackendProvider) *StrategyStickySessions {
-	return &StrategyStickySessions{
-		sessionMap: make(map[string]*Backend),
+func NewP2CPeakEWMAStrategy(provider BackendProvider) *StrategyP2CPeakEWMA {
+	return &StrategyP2CPeakEWMA{
 		provider: provider,
 	}
 }
 
-func (ss *StrategyStickySessions) SelectBackend(req *http.Request) *Backend {
-	sessionIDCookie, err := req.Cookie("SESSIONID")
-	var sessionID string
-	if err != nil {
-		sessionID = sessionIDCookie.Value
-	}
+// latency scaled by the requests already waiting on the backend
+func peakEWMAScore(b *Backend) float64 {
+	return float64(b.GetLatencyEWMA()) * float64(b.GetConnections()+1)
+}
 
-	if sessionID == "" {
-		ss.mu.Lock()
-		backend, found := ss.sessionMap[sessionID]
-		ss.mu.RUnlock()
+func (p2c *StrategyP2CPeakEWMA) SelectBackend(req *http.Request) *Backend {
+	backends := candidateBackends(req, p2c.provider)
+	if len(backends) == 0 {
+		return nil
+	}
+	if len(backends) == 1 {
+		return backends[0]
+	}
 
-		if found && backend.IsAlive() {
-			log.Printf("Sticky Session: Reusing backend %s for session %s", backend.URL.String(), sessionID)
-			return backend
-		} else if found && !backend.IsAlive() {
-			log.Printf("Sticky Session: Backend %s for session %s is unhealthy, re-selecting", backend.URL.String(), sessionID)
-			ss.mu.Lock()
-			delete(ss.sessionMap, sessionID)
-			ss.mu.Unlock()
-		}
+	// comparing two random backends avoids herding onto a single "best" one
+	i := rand.IntN(len(backends))
+	j := rand.IntN(len(backends) - 1)
+	if j >= i {
+		j++
 	}
+	first, second := backends[i], backends[j]
+	firstScore, secondScore := peakEWMAScore(first), peakEWMAScore(second)
 
-	// init selection
-	log.Println("Sticky Session: No existing session or backend unhealthy, performing initial selection")
-	newBackend := NewRoundRobinStrategy(ss.provider).SelectBackend(req)
-
-	if newBackend != nil && sessionID != "" {
-		ss.mu.Lock()
-		ss.sessionMap[sessionID] = newBackend
-		ss.mu.Unlock()
-		log.Printf("Sticky Session: New backend %s assigned to session %s", newBackend.URL.String(), sessionID)
-	} else if sessionID == "" {
-		newSessionID := GenerateSessionID()
-		http.SetCookie(req.Context().Value("responseWriter").(http.ResponseWriter), &http.Cookie{
-			Name: "SESSIONID",
-			Value: newSessionID,
-			Path: "/",
-			Expires: time.Now().Add(24 * time.Hour),
-		})
-		ss.mu.Lock()
-		ss.sessionMap[newSessionID] = newBackend
-		ss.mu.Unlock()
-		log.Printf("Sticky Session: New session ID %s created and assigned to backend %s", newSessionID, newBackend.URL.String())
-	}
-	return newBackend
-}
-
-func (ss *StrategyStickySessions) AddBackend(backend *Backend) {}
-
-func (ss *StrategyStickySessions) RemoveBackend(backend *Backend) {
-	ss.mu.Lock()
-	for sessionID, b := range ss.sessionMap {
-		if b == backend {
-			delete(ss.sessionMap, sessionID)
-			log.Printf("Sticky Session: Removed session %s mapping for unhealthy backend %s", sessionID, backend.URL.String())
-		}
+	selected := first
+	if secondScore < firstScore {
+		selected = second
 	}
-	ss.mu.Unlock()
+	log.Printf("P2C Peak EWMA selected backend: %s (scores: %.0f vs %.0f)", selected.URL.String(), firstScore, secondScore)
+	return selected
 }
 
-func GenerateSessionID() string {
-	return "sess-" + time.Now().Format("20060102150405.000000")
-}
\ No newline at end of file
+func (p2c *StrategyP2CPeakEWMA) AddBackend(backend *Backend) {}
+
+func (p2c *StrategyP2CPeakEWMA) RemoveBackend(backend *Backend) {}
+
+func (p2c *StrategyP2CPeakEWMA) State() any {
+	scores := make(map[string]float64)
+	for _, b := range p2c.provider.GetHealthyBackends() {
+		scores[b.InstanceID] = peakEWMAScore(b)
+	}
+	return map[string]any{
+		"scores": scores,
+	}
+}
@@ -0,0 +1,57 @@
+package balancer
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+)
+
+// a fixed healthy snapshot, as the manager publishes it
+type staticProvider []*Backend
+
+func (p staticProvider) GetHealthyBackends() []*Backend {
+	return p
+}
+
+func newBenchmarkBackends(n int) staticProvider {
+	backends := make(staticProvider, n)
+	for i := range backends {
+		backends[i] = &Backend{
+			URL:        &url.URL{Scheme: "http", Host: fmt.Sprintf("10.0.0.%d:8080", i+1)},
+			Alive:      true,
+			InstanceID: fmt.Sprintf("instance-%d", i+1),
+			Weight:     i%3 + 1,
+		}
+	}
+	return backends
+}
+
+func BenchmarkSelectBackend(b *testing.B) {
+	// every strategy logs its pick
+	log.SetOutput(io.Discard)
+	b.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	provider := newBenchmarkBackends(8)
+	strategies := []string{"round_robin", "weighted_round_robin", "least_connections", "p2c_peak_ewma", "consistent_hash", "sticky_sessions"}
+	for _, name := range strategies {
+		b.Run(name, func(b *testing.B) {
+			strategy, err := NewStrategy(name, provider, StrategyOptions{})
+			if err != nil {
+				b.Fatal(err)
+			}
+			req := httptest.NewRequest("GET", "http://lb.example.com/orders", nil)
+			req.RemoteAddr = "192.0.2.10:51234"
+
+			b.ReportAllocs()
+			for b.Loop() {
+				if strategy.SelectBackend(req) == nil {
+					b.Fatal("no backend selected")
+				}
+			}
+		})
+	}
+}
@@ -2,19 +2,272 @@ package config
 
 import (
 	"fmt"
+	"net/url"
 	"os"
+	"reflect"
+	"regexp"
+	"time"
 
+	"github.com/lokeshllkumar/load-balancer/internal/healthcheck"
+	"github.com/lokeshllkumar/load-balancer/internal/netutil"
+	"github.com/lokeshllkumar/load-balancer/internal/proxyproto"
+	"github.com/lokeshllkumar/load-balancer/internal/tlsutil"
 	"gopkg.in/yaml.v3"
 )
 
 type Config struct {
-	Port                int    `yaml:"port"`
-	Strategy            string `yaml:"strategy"`
-	ServiceRegsistryUrl string `yaml:"serviceRegistryURL"`
-	ServiceRegistryType string `yaml:"serviceRegistryType"`
-	HealthCheckInterval string `yaml:"healthCheckInterval"`
-	BackendHealthPath   string `yaml:"backendHealthPath"`
-	HealthCheckTimeout  string `yaml:"healthCheckTimeout"` // can change to float32
+	Port                int                    `yaml:"port"`
+	Strategy            string                 `yaml:"strategy"`
+	ServiceRegsistryUrl string                 `yaml:"serviceRegistryURL"`
+	ServiceRegistryType string                 `yaml:"serviceRegistryType"`
+	RegistryTLS         ClientTLSConfig        `yaml:"registryTLS"`
+	HealthCheckInterval string                 `yaml:"healthCheckInterval"`
+	BackendHealthPath   string                 `yaml:"backendHealthPath"`
+	HealthCheckTimeout  string                 `yaml:"healthCheckTimeout"` // can change to float32
+	HealthCheck         HealthCheckConfig      `yaml:"healthCheck"`
+	Weights             map[string]int         `yaml:"weights"`
+	ConsistentHash      ConsistentHashConfig   `yaml:"consistentHash"`
+	StickySessions      StickySessionsConfig   `yaml:"stickySessions"`
+	CircuitBreaker      CircuitBreakerConfig   `yaml:"circuitBreaker"`
+	OutlierDetection    OutlierDetectionConfig `yaml:"outlierDetection"`
+	Retries             RetryConfig            `yaml:"retries"`
+	RetryBudget         RetryBudgetConfig      `yaml:"retryBudget"` // shared by all services
+	Transport           TransportConfig        `yaml:"transport"`
+	Streaming           StreamingConfig        `yaml:"streaming"`
+	Services            []ServiceConfig        `yaml:"services"`
+	Routes              []RouteConfig          `yaml:"routes"`
+	DrainTimeout        string                 `yaml:"drainTimeout"`        // how long deregistered backends may finish in-flight requests
+	ConfigWatchInterval string                 `yaml:"configWatchInterval"` // reloads when the file changes, unset disables watching
+	Admin               AdminConfig            `yaml:"admin"`
+	TLS                 TLSConfig              `yaml:"tls"`
+	TCPListeners        []TCPListenerConfig    `yaml:"tcpListeners"`
+	UDPListeners        []UDPListenerConfig    `yaml:"udpListeners"`
+	ProxyProtocol       ProxyProtocolConfig    `yaml:"proxyProtocol"`
+	Forwarded           ForwardedConfig        `yaml:"forwarded"`
+	SessionStore        SessionStoreConfig     `yaml:"sessionStore"` // shared by all services, changes need a restart
+}
+
+// where sticky_sessions keeps session to backend mappings; unset keeps the backend in the cookie itself
+type SessionStoreConfig struct {
+	Type        string            `yaml:"type"`       // memory or file
+	Path        string            `yaml:"path"`       // write-ahead log for the file store
+	MaxEntries  int               `yaml:"maxEntries"` // sessions kept before the least recently used one is evicted, defaults to 100000
+	Replication ReplicationConfig `yaml:"replication"`
+}
+
+// shares sessions with other replicas over a listener of its own, so the admin API can stay on loopback
+type ReplicationConfig struct {
+	Host  string   `yaml:"host"`  // defaults to every interface, peers on other hosts have to reach it
+	Port  int      `yaml:"port"`  // required with peers
+	Peers []string `yaml:"peers"` // replication listener base URLs of the other replicas, e.g. http://10.0.0.2:9095
+	Token string   `yaml:"token"` // required with peers, sent to them and required from them
+}
+
+// Forwarded and X-Forwarded-* handling; chains are only believed, and extended, when they come from a trusted proxy
+type ForwardedConfig struct {
+	TrustedCIDRs []string `yaml:"trustedCIDRs"` // unset trusts no one, clients' forwarding headers are replaced
+}
+
+// PROXY protocol (v1 or v2) on the HTTP, HTTPS and TCP listeners, for running behind another layer 4 load balancer
+type ProxyProtocolConfig struct {
+	TrustedCIDRs []string `yaml:"trustedCIDRs"` // peers that must send a header; others are taken at face value, unset disables parsing
+}
+
+// a layer 4 listener splicing connections to the backends of a service; changes need a restart
+type TCPListenerConfig struct {
+	Name              string `yaml:"name"`
+	Port              int    `yaml:"port"`
+	Service           string `yaml:"service"`
+	ConnectTimeout    string `yaml:"connectTimeout"`    // defaults to 5s
+	IdleTimeout       string `yaml:"idleTimeout"`       // closes connections without traffic in either direction, unset never does
+	SendProxyProtocol string `yaml:"sendProxyProtocol"` // v1 or v2 header sent to backends with the client's address, unset sends none
+}
+
+// forwards datagrams to the backends of a service, keeping each client address on one backend; changes need a restart
+type UDPListenerConfig struct {
+	Name           string `yaml:"name"`
+	Port           int    `yaml:"port"`
+	Service        string `yaml:"service"`
+	SessionTimeout string `yaml:"sessionTimeout"` // how long a client keeps its backend without traffic, defaults to 30s
+	MaxSessions    int    `yaml:"maxSessions"`    // sessions open at once, new clients are dropped beyond it; defaults to 10000
+}
+
+// HTTPS termination; listener changes need a restart but certificate files are reloaded when they change
+type TLSConfig struct {
+	Port               int                 `yaml:"port"`         // unset disables the HTTPS listener
+	Certificates       []CertificateConfig `yaml:"certificates"` // picked by SNI, the first one is the default
+	MinVersion         string              `yaml:"minVersion"`   // 1.0 to 1.3, defaults to 1.2
+	CipherSuites       []string            `yaml:"cipherSuites"` // IANA names, TLS 1.2 and below; Go's defaults when unset
+	CertReloadInterval string              `yaml:"certReloadInterval"`
+	RedirectHTTP       bool                `yaml:"redirectHTTP"` // the plain HTTP port redirects to HTTPS instead of proxying
+}
+
+// outgoing TLS settings; unset fields use the system roots and no client certificate
+type ClientTLSConfig struct {
+	Enabled            bool   `yaml:"enabled"` // for gRPC registries, which have no scheme to go by; implied by any other field
+	CAFile             string `yaml:"caFile"`
+	CertFile           string `yaml:"certFile"` // client certificate for mTLS
+	KeyFile            string `yaml:"keyFile"`
+	ServerName         string `yaml:"serverName"`
+	InsecureSkipVerify bool   `yaml:"insecureSkipVerify"`
+}
+
+func (t ClientTLSConfig) IsSet() bool {
+	return t != ClientTLSConfig{}
+}
+
+func (t ClientTLSConfig) validate() error {
+	if (t.CertFile == "") != (t.KeyFile == "") {
+		return fmt.Errorf("certFile and keyFile must be set together")
+	}
+	return nil
+}
+
+type CertificateConfig struct {
+	CertFile string `yaml:"certFile"`
+	KeyFile  string `yaml:"keyFile"`
+}
+
+// the admin API listener, kept off the proxy port; unset port disables it
+type AdminConfig struct {
+	Host string `yaml:"host"` // defaults to loopback, the API is unauthenticated
+	Port int    `yaml:"port"`
+}
+
+// a named pool of backends, matched against the serviceName reported by the registry
+type ServiceConfig struct {
+	Name                string                 `yaml:"name"`
+	Strategy            string                 `yaml:"strategy"`
+	HealthCheckInterval string                 `yaml:"healthCheckInterval"`
+	BackendHealthPath   string                 `yaml:"backendHealthPath"`
+	HealthCheckTimeout  string                 `yaml:"healthCheckTimeout"`
+	HealthCheck         HealthCheckConfig      `yaml:"healthCheck"`
+	Weights             map[string]int         `yaml:"weights"` // by instance ID, used when the registry does not report a weight
+	ConsistentHash      ConsistentHashConfig   `yaml:"consistentHash"`
+	StickySessions      StickySessionsConfig   `yaml:"stickySessions"`
+	CircuitBreaker      CircuitBreakerConfig   `yaml:"circuitBreaker"`
+	OutlierDetection    OutlierDetectionConfig `yaml:"outlierDetection"`
+	Retries             RetryConfig            `yaml:"retries"`
+	DrainTimeout        string                 `yaml:"drainTimeout"`
+	Transport           TransportConfig        `yaml:"transport"`
+	Streaming           StreamingConfig        `yaml:"streaming"`
+}
+
+// how backends are probed; an instance's healthCheckType registry metadata overrides the type
+type HealthCheckConfig struct {
+	Type                string            `yaml:"type"`   // http, tcp or grpc; unset uses tcp for tcp:// backends and http for the rest
+	Method              string            `yaml:"method"` // defaults to GET
+	Headers             map[string]string `yaml:"headers"`
+	Host                string            `yaml:"host"`             // Host header sent instead of the backend's address
+	ExpectedStatuses    []string          `yaml:"expectedStatuses"` // codes or ranges such as 200-399 or 2xx, defaults to 200
+	BodyRegex           string            `yaml:"bodyRegex"`
+	JSONField           string            `yaml:"jsonField"` // dot-separated path into a JSON body, compared with jsonValue
+	JSONValue           string            `yaml:"jsonValue"`
+	GRPCService         string            `yaml:"grpcService"`         // service name asked about over grpc.health.v1, unset asks about the whole server
+	HealthyThreshold    int               `yaml:"healthyThreshold"`    // consecutive successes to bring a backend back, defaults to 1
+	UnhealthyThreshold  int               `yaml:"unhealthyThreshold"`  // consecutive failures to take a backend out, defaults to 1
+	Jitter              string            `yaml:"jitter"`              // random delay before each probe, defaults to a tenth of the interval, negative disables
+	MaxConcurrentProbes int               `yaml:"maxConcurrentProbes"` // per service, defaults to 16
+}
+
+func (hc HealthCheckConfig) IsSet() bool {
+	return !reflect.DeepEqual(hc, HealthCheckConfig{})
+}
+
+// handling of streamed responses and upgraded (WebSocket) connections
+type StreamingConfig struct {
+	FlushInterval string `yaml:"flushInterval"` // negative flushes after every write; event streams always do
+	IdleTimeout   string `yaml:"idleTimeout"`   // closes upgraded connections without traffic, unset never does
+}
+
+// settings for the connections to each backend, unset fields fall back to the balancer defaults
+type TransportConfig struct {
+	MaxIdleConnsPerHost   int             `yaml:"maxIdleConnsPerHost"`
+	IdleConnTimeout       string          `yaml:"idleConnTimeout"`
+	DialTimeout           string          `yaml:"dialTimeout"`
+	KeepAlive             string          `yaml:"keepAlive"` // TCP keepalive period, negative disables
+	ResponseHeaderTimeout string          `yaml:"responseHeaderTimeout"`
+	TLSHandshakeTimeout   string          `yaml:"tlsHandshakeTimeout"`
+	TLS                   ClientTLSConfig `yaml:"tls"` // for https:// backends
+	DisableHTTP2          bool            `yaml:"disableHTTP2"`
+}
+
+// settings for the consistent_hash strategy
+type ConsistentHashConfig struct {
+	Key          string  `yaml:"key"`          // ip (default), header, cookie or path
+	KeyName      string  `yaml:"keyName"`      // header or cookie name
+	PathSegment  int     `yaml:"pathSegment"`  // 1-based index of the path segment to hash
+	VirtualNodes int     `yaml:"virtualNodes"` // ring points per backend
+	LoadFactor   float64 `yaml:"loadFactor"`   // max connections relative to the pool average, 0 disables bounded loads
+}
+
+// settings for the sticky_sessions strategy; clients without a valid cookie are placed by consistentHash
+type StickySessionsConfig struct {
+	CookieName string `yaml:"cookieName"` // defaults to SESSIONID
+	TTL        string `yaml:"ttl"`        // defaults to 24h, refreshed while the client keeps coming back
+	Secret     string `yaml:"secret"`     // signs cookies, must be shared by replicas; unset generates one per process
+	Path       string `yaml:"path"`       // defaults to /
+	Domain     string `yaml:"domain"`
+	Secure     bool   `yaml:"secure"`
+	HTTPOnly   bool   `yaml:"httpOnly"`
+	SameSite   string `yaml:"sameSite"` // lax, strict or none; unset leaves it to the browser
+}
+
+// ejects backends whose live traffic fails more than the rest of the pool; unset fields fall back to the balancer defaults
+type OutlierDetectionConfig struct {
+	Enabled                   bool    `yaml:"enabled"`
+	Consecutive5xx            int     `yaml:"consecutive5xx"`            // negative disables
+	ConsecutiveGatewayFailure int     `yaml:"consecutiveGatewayFailure"` // 502, 503, 504 and failed requests; negative disables
+	Interval                  string  `yaml:"interval"`
+	BaseEjectionTime          string  `yaml:"baseEjectionTime"` // multiplied by the number of ejections, up to maxEjectionTime
+	MaxEjectionTime           string  `yaml:"maxEjectionTime"`
+	MaxEjectionPercent        int     `yaml:"maxEjectionPercent"`
+	SuccessRateMinimumHosts   int     `yaml:"successRateMinimumHosts"` // negative disables success rate ejection
+	SuccessRateRequestVolume  int     `yaml:"successRateRequestVolume"`
+	SuccessRateStdevFactor    float64 `yaml:"successRateStdevFactor"`
+	SlowResponseThreshold     string  `yaml:"slowResponseThreshold"` // slower responses count as failures for the success rate
+}
+
+// per-backend circuit breaker settings, unset fields fall back to the balancer defaults
+type CircuitBreakerConfig struct {
+	ConsecutiveFailures int     `yaml:"consecutiveFailures"` // negative disables
+	ErrorRateThreshold  float64 `yaml:"errorRateThreshold"`  // 0-1, 0 disables
+	MinRequests         int     `yaml:"minRequests"`
+	Window              string  `yaml:"window"`
+	OpenDuration        string  `yaml:"openDuration"`
+	HalfOpenRequests    int     `yaml:"halfOpenRequests"`
+}
+
+// retries of failed requests on a different backend
+type RetryConfig struct {
+	MaxRetries   int   `yaml:"maxRetries"`   // 0 disables retries
+	MaxBodyBytes int64 `yaml:"maxBodyBytes"` // larger request bodies are never retried
+}
+
+// limits retries to a share of live traffic
+type RetryBudgetConfig struct {
+	Percent             float64 `yaml:"percent"`
+	MinRetriesPerSecond int     `yaml:"minRetriesPerSecond"`
+}
+
+// maps incoming requests to a service pool; all of the set matchers must match
+type RouteConfig struct {
+	Name       string          `yaml:"name"` // labels the route's metrics, defaults to route-<index>
+	Host       string          `yaml:"host"`
+	PathPrefix string          `yaml:"pathPrefix"`
+	PathRegex  string          `yaml:"pathRegex"`
+	Methods    []string        `yaml:"methods"`
+	Service    string          `yaml:"service"`
+	RateLimit  RateLimitConfig `yaml:"rateLimit"`
+}
+
+// token bucket limit on the requests a route accepts per key; limiter state starts over on reload
+type RateLimitConfig struct {
+	RequestsPerSecond float64 `yaml:"requestsPerSecond"` // 0 disables limiting
+	Burst             int     `yaml:"burst"`             // defaults to one second's worth of requests
+	Key               string  `yaml:"key"`               // ip (default), header, apiKey or route (one bucket for everyone)
+	KeyName           string  `yaml:"keyName"`           // header name, apiKey defaults to X-API-Key and also reads bearer tokens
+	MaxKeys           int     `yaml:"maxKeys"`           // buckets kept in memory, least recently used evicted first; defaults to 10000
 }
 
 func LoadConfig(filePath string) (*Config, error) {
@@ -28,5 +281,524 @@ func LoadConfig(filePath string) (*Config, error) {
 		return nil, fmt.Errorf("failed to unmarshal config object: %v", err)
 	}
 
+	cfg.applyDefaults()
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %v", err)
+	}
+
 	return &cfg, nil
 }
+
+// services inherit the top-level settings they do not override
+func (c *Config) applyDefaults() {
+	// without an explicit service list, every registered instance belongs to a single unnamed pool
+	if len(c.Services) == 0 {
+		c.Services = []ServiceConfig{{}}
+	}
+	for i := range c.Services {
+		svc := &c.Services[i]
+		if svc.Strategy == "" {
+			svc.Strategy = c.Strategy
+		}
+		if svc.HealthCheckInterval == "" {
+			svc.HealthCheckInterval = c.HealthCheckInterval
+		}
+		if svc.HealthCheckTimeout == "" {
+			svc.HealthCheckTimeout = c.HealthCheckTimeout
+		}
+		if svc.BackendHealthPath == "" {
+			svc.BackendHealthPath = c.BackendHealthPath
+		}
+		if !svc.HealthCheck.IsSet() {
+			svc.HealthCheck = c.HealthCheck
+		}
+		if svc.Weights == nil {
+			svc.Weights = c.Weights
+		}
+		if svc.ConsistentHash == (ConsistentHashConfig{}) {
+			svc.ConsistentHash = c.ConsistentHash
+		}
+		if svc.StickySessions == (StickySessionsConfig{}) {
+			svc.StickySessions = c.StickySessions
+		}
+		if svc.CircuitBreaker == (CircuitBreakerConfig{}) {
+			svc.CircuitBreaker = c.CircuitBreaker
+		}
+		if svc.OutlierDetection == (OutlierDetectionConfig{}) {
+			svc.OutlierDetection = c.OutlierDetection
+		}
+		if svc.Retries == (RetryConfig{}) {
+			svc.Retries = c.Retries
+		}
+		if svc.DrainTimeout == "" {
+			svc.DrainTimeout = c.DrainTimeout
+		}
+		if svc.Transport == (TransportConfig{}) {
+			svc.Transport = c.Transport
+		}
+		if svc.Streaming == (StreamingConfig{}) {
+			svc.Streaming = c.Streaming
+		}
+	}
+
+	if c.Admin.Port != 0 && c.Admin.Host == "" {
+		c.Admin.Host = "127.0.0.1"
+	}
+
+	// a single pool receives all traffic if no routes are set
+	if len(c.Routes) == 0 && len(c.Services) == 1 {
+		c.Routes = []RouteConfig{{Service: c.Services[0].Name}}
+	}
+	for i := range c.Routes {
+		if c.Routes[i].Name == "" {
+			c.Routes[i].Name = fmt.Sprintf("route-%d", i)
+		}
+	}
+}
+
+func (c *Config) Validate() error {
+	services := make(map[string]bool, len(c.Services))
+	for _, svc := range c.Services {
+		if services[svc.Name] {
+			return fmt.Errorf("duplicate service %q", svc.Name)
+		}
+		services[svc.Name] = true
+
+		interval, err := time.ParseDuration(svc.HealthCheckInterval)
+		if err != nil {
+			return fmt.Errorf("service %q has an invalid health check interval: %v", svc.Name, err)
+		}
+		if interval <= 0 {
+			return fmt.Errorf("service %q health check interval must be positive", svc.Name)
+		}
+		timeout, err := time.ParseDuration(svc.HealthCheckTimeout)
+		if err != nil {
+			return fmt.Errorf("service %q has an invalid health check timeout: %v", svc.Name, err)
+		}
+		if timeout <= 0 {
+			return fmt.Errorf("service %q health check timeout must be positive", svc.Name)
+		}
+
+		if err := svc.HealthCheck.validate(interval); err != nil {
+			return fmt.Errorf("service %q: %v", svc.Name, err)
+		}
+
+		for instanceID, weight := range svc.Weights {
+			if weight < 1 {
+				return fmt.Errorf("service %q has a non-positive weight for instance %q", svc.Name, instanceID)
+			}
+		}
+		if err := svc.ConsistentHash.validate(); err != nil {
+			return fmt.Errorf("service %q: %v", svc.Name, err)
+		}
+		if err := svc.StickySessions.validate(); err != nil {
+			return fmt.Errorf("service %q: %v", svc.Name, err)
+		}
+		if err := svc.CircuitBreaker.validate(); err != nil {
+			return fmt.Errorf("service %q: %v", svc.Name, err)
+		}
+		if err := svc.OutlierDetection.validate(); err != nil {
+			return fmt.Errorf("service %q: %v", svc.Name, err)
+		}
+		if svc.Retries.MaxRetries < 0 || svc.Retries.MaxBodyBytes < 0 {
+			return fmt.Errorf("service %q: retry settings must not be negative", svc.Name)
+		}
+		if _, err := ParseOptionalDuration(svc.DrainTimeout); err != nil {
+			return fmt.Errorf("service %q has an invalid drain timeout: %v", svc.Name, err)
+		}
+		if err := svc.Transport.TLS.validate(); err != nil {
+			return fmt.Errorf("service %q: invalid transport tls: %v", svc.Name, err)
+		}
+		if err := svc.Transport.validate(); err != nil {
+			return fmt.Errorf("service %q: %v", svc.Name, err)
+		}
+		if _, err := ParseOptionalDuration(svc.Streaming.FlushInterval); err != nil {
+			return fmt.Errorf("service %q has an invalid streaming flushInterval: %v", svc.Name, err)
+		}
+		if d, err := ParseOptionalDuration(svc.Streaming.IdleTimeout); err != nil || d < 0 {
+			return fmt.Errorf("service %q has an invalid streaming idleTimeout %q", svc.Name, svc.Streaming.IdleTimeout)
+		}
+	}
+
+	if _, err := ParseOptionalDuration(c.ConfigWatchInterval); err != nil {
+		return fmt.Errorf("invalid config watch interval: %v", err)
+	}
+
+	if c.Admin.Port < 0 || c.Admin.Port > 65535 {
+		return fmt.Errorf("invalid admin port: %d", c.Admin.Port)
+	}
+	if c.Admin.Port != 0 && c.Admin.Port == c.Port {
+		return fmt.Errorf("admin port must differ from the load balancer port")
+	}
+
+	if err := c.RegistryTLS.validate(); err != nil {
+		return fmt.Errorf("invalid registryTLS: %v", err)
+	}
+
+	if err := c.TLS.validate(c.Port, c.Admin.Port); err != nil {
+		return err
+	}
+
+	if _, err := netutil.ParseCIDRs(c.ProxyProtocol.TrustedCIDRs); err != nil {
+		return fmt.Errorf("invalid proxyProtocol trustedCIDRs: %v", err)
+	}
+	if _, err := netutil.ParseCIDRs(c.Forwarded.TrustedCIDRs); err != nil {
+		return fmt.Errorf("invalid forwarded trustedCIDRs: %v", err)
+	}
+
+	if err := c.validateTCPListeners(services); err != nil {
+		return err
+	}
+	if err := c.validateUDPListeners(services); err != nil {
+		return err
+	}
+
+	if err := c.validateSessionStore(); err != nil {
+		return err
+	}
+
+	if c.RetryBudget.Percent < 0 || c.RetryBudget.MinRetriesPerSecond < 0 {
+		return fmt.Errorf("retry budget settings must not be negative")
+	}
+
+	if len(c.Routes) == 0 {
+		return fmt.Errorf("routes must be defined when multiple services are configured")
+	}
+	routeNames := make(map[string]bool, len(c.Routes))
+	for i, route := range c.Routes {
+		if routeNames[route.Name] {
+			return fmt.Errorf("duplicate route name %q", route.Name)
+		}
+		routeNames[route.Name] = true
+		if !services[route.Service] {
+			return fmt.Errorf("route %d references unknown service %q", i, route.Service)
+		}
+		if route.PathRegex != "" {
+			if _, err := regexp.Compile(route.PathRegex); err != nil {
+				return fmt.Errorf("route %d has an invalid path regex: %v", i, err)
+			}
+		}
+		if err := route.RateLimit.validate(); err != nil {
+			return fmt.Errorf("route %d: %v", i, err)
+		}
+	}
+
+	return nil
+}
+
+func (c *Config) validateTCPListeners(services map[string]bool) error {
+	ports := map[int]bool{c.Port: true}
+	if c.Admin.Port != 0 {
+		ports[c.Admin.Port] = true
+	}
+	if c.TLS.Port != 0 {
+		ports[c.TLS.Port] = true
+	}
+	for i, listener := range c.TCPListeners {
+		if listener.Name == "" {
+			return fmt.Errorf("tcp listener %d needs a name", i)
+		}
+		if listener.Port < 1 || listener.Port > 65535 {
+			return fmt.Errorf("tcp listener %q has an invalid port: %d", listener.Name, listener.Port)
+		}
+		if ports[listener.Port] {
+			return fmt.Errorf("tcp listener %q port %d is already in use", listener.Name, listener.Port)
+		}
+		ports[listener.Port] = true
+		if !services[listener.Service] {
+			return fmt.Errorf("tcp listener %q references unknown service %q", listener.Name, listener.Service)
+		}
+		if err := c.checkLayer4Strategy(listener.Service); err != nil {
+			return fmt.Errorf("tcp listener %q: %v", listener.Name, err)
+		}
+		if _, err := proxyproto.ParseVersion(listener.SendProxyProtocol); err != nil {
+			return fmt.Errorf("tcp listener %q: invalid sendProxyProtocol: %v", listener.Name, err)
+		}
+		for name, value := range map[string]string{"connectTimeout": listener.ConnectTimeout, "idleTimeout": listener.IdleTimeout} {
+			if d, err := ParseOptionalDuration(value); err != nil || d < 0 {
+				return fmt.Errorf("tcp listener %q has an invalid %s %q", listener.Name, name, value)
+			}
+		}
+	}
+	return nil
+}
+
+func (c *Config) validateUDPListeners(services map[string]bool) error {
+	ports := make(map[int]bool, len(c.UDPListeners))
+	for i, listener := range c.UDPListeners {
+		if listener.Name == "" {
+			return fmt.Errorf("udp listener %d needs a name", i)
+		}
+		if listener.Port < 1 || listener.Port > 65535 {
+			return fmt.Errorf("udp listener %q has an invalid port: %d", listener.Name, listener.Port)
+		}
+		if ports[listener.Port] {
+			return fmt.Errorf("udp listener %q port %d is already in use", listener.Name, listener.Port)
+		}
+		ports[listener.Port] = true
+		if !services[listener.Service] {
+			return fmt.Errorf("udp listener %q references unknown service %q", listener.Name, listener.Service)
+		}
+		if err := c.checkLayer4Strategy(listener.Service); err != nil {
+			return fmt.Errorf("udp listener %q: %v", listener.Name, err)
+		}
+		if d, err := ParseOptionalDuration(listener.SessionTimeout); err != nil || d < 0 {
+			return fmt.Errorf("udp listener %q has an invalid sessionTimeout %q", listener.Name, listener.SessionTimeout)
+		}
+		if listener.MaxSessions < 0 {
+			return fmt.Errorf("udp listener %q maxSessions must not be negative", listener.Name)
+		}
+	}
+	return nil
+}
+
+// sessions are tracked with HTTP cookies and hash keys read from headers, cookies and paths,
+// none of which raw connections and datagrams carry
+func (c *Config) checkLayer4Strategy(service string) error {
+	for _, svc := range c.Services {
+		if svc.Name != service {
+			continue
+		}
+		if svc.Strategy == "sticky_sessions" {
+			return fmt.Errorf("strategy sticky_sessions of service %q cannot balance raw connections", svc.Name)
+		}
+		if svc.Strategy == "consistent_hash" && svc.ConsistentHash.Key != "" && svc.ConsistentHash.Key != "ip" {
+			return fmt.Errorf("consistent hash key %q of service %q cannot balance raw connections, only \"ip\" can", svc.ConsistentHash.Key, svc.Name)
+		}
+	}
+	return nil
+}
+
+func (ch ConsistentHashConfig) validate() error {
+	switch ch.Key {
+	case "", "ip":
+	case "header", "cookie":
+		if ch.KeyName == "" {
+			return fmt.Errorf("consistent hash key %q requires a keyName", ch.Key)
+		}
+	case "path":
+		if ch.PathSegment < 1 {
+			return fmt.Errorf("consistent hash key \"path\" requires a pathSegment of at least 1")
+		}
+	default:
+		return fmt.Errorf("unsupported consistent hash key: %s", ch.Key)
+	}
+
+	if ch.VirtualNodes < 0 {
+		return fmt.Errorf("consistent hash virtualNodes must not be negative")
+	}
+	if ch.LoadFactor != 0 && ch.LoadFactor < 1 {
+		return fmt.Errorf("consistent hash loadFactor must be 0 (disabled) or at least 1")
+	}
+	return nil
+}
+
+func (hc HealthCheckConfig) validate(interval time.Duration) error {
+	if !healthcheck.ValidType(hc.Type) {
+		return fmt.Errorf("unsupported health check type: %s", hc.Type)
+	}
+	if _, err := healthcheck.ParseStatusRanges(hc.ExpectedStatuses); err != nil {
+		return fmt.Errorf("invalid health check expectedStatuses: %v", err)
+	}
+	if _, err := regexp.Compile(hc.BodyRegex); err != nil {
+		return fmt.Errorf("invalid health check bodyRegex: %v", err)
+	}
+	if hc.JSONValue != "" && hc.JSONField == "" {
+		return fmt.Errorf("health check jsonValue requires a jsonField")
+	}
+	if hc.HealthyThreshold < 0 || hc.UnhealthyThreshold < 0 || hc.MaxConcurrentProbes < 0 {
+		return fmt.Errorf("health check thresholds and maxConcurrentProbes must not be negative")
+	}
+	jitter, err := ParseOptionalDuration(hc.Jitter)
+	if err != nil {
+		return fmt.Errorf("invalid health check jitter: %v", err)
+	}
+	// rounds would otherwise run into each other
+	if jitter >= interval {
+		return fmt.Errorf("health check jitter must be shorter than the interval")
+	}
+	return nil
+}
+
+func (rl RateLimitConfig) validate() error {
+	if rl.RequestsPerSecond < 0 || rl.Burst < 0 || rl.MaxKeys < 0 {
+		return fmt.Errorf("rate limit settings must not be negative")
+	}
+	switch rl.Key {
+	case "", "ip", "apiKey", "route":
+	case "header":
+		if rl.KeyName == "" {
+			return fmt.Errorf("rate limit key \"header\" requires a keyName")
+		}
+	default:
+		return fmt.Errorf("unsupported rate limit key: %s", rl.Key)
+	}
+	return nil
+}
+
+func (c *Config) validateSessionStore() error {
+	store := c.SessionStore
+	switch store.Type {
+	case "":
+		if len(store.Replication.Peers) > 0 {
+			return fmt.Errorf("sessionStore replication requires a sessionStore type")
+		}
+		return nil
+	case "memory":
+	case "file":
+		if store.Path == "" {
+			return fmt.Errorf("sessionStore type \"file\" requires a path")
+		}
+	default:
+		return fmt.Errorf("unsupported sessionStore type: %s", store.Type)
+	}
+	if store.MaxEntries < 0 {
+		return fmt.Errorf("sessionStore maxEntries must not be negative")
+	}
+	if len(store.Replication.Peers) == 0 {
+		return nil
+	}
+	// anyone reaching the listener could otherwise read every session and pin clients to backends of their choosing
+	if store.Replication.Token == "" {
+		return fmt.Errorf("sessionStore replication requires a token")
+	}
+	port := store.Replication.Port
+	if port < 1 || port > 65535 {
+		return fmt.Errorf("sessionStore replication has an invalid port: %d", port)
+	}
+	if port == c.Port || port == c.Admin.Port || port == c.TLS.Port {
+		return fmt.Errorf("sessionStore replication port %d is already in use", port)
+	}
+	for _, listener := range c.TCPListeners {
+		if port == listener.Port {
+			return fmt.Errorf("sessionStore replication port %d is already in use by tcp listener %q", port, listener.Name)
+		}
+	}
+	for _, peer := range store.Replication.Peers {
+		u, err := url.Parse(peer)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid sessionStore replication peer %q", peer)
+		}
+	}
+	return nil
+}
+
+func (ss StickySessionsConfig) validate() error {
+	if d, err := ParseOptionalDuration(ss.TTL); err != nil || d < 0 {
+		return fmt.Errorf("invalid sticky sessions ttl %q", ss.TTL)
+	}
+	if ss.Secret != "" && len(ss.Secret) < 16 {
+		return fmt.Errorf("sticky sessions secret must be at least 16 characters")
+	}
+	switch ss.SameSite {
+	case "", "lax", "strict":
+	case "none":
+		// browsers drop SameSite=None cookies that are not also Secure
+		if !ss.Secure {
+			return fmt.Errorf("sticky sessions sameSite \"none\" requires secure")
+		}
+	default:
+		return fmt.Errorf("unsupported sticky sessions sameSite: %s", ss.SameSite)
+	}
+	return nil
+}
+
+func (cb CircuitBreakerConfig) validate() error {
+	if cb.ErrorRateThreshold < 0 || cb.ErrorRateThreshold > 1 {
+		return fmt.Errorf("circuit breaker errorRateThreshold must be between 0 and 1")
+	}
+	if _, err := ParseOptionalDuration(cb.Window); err != nil {
+		return fmt.Errorf("invalid circuit breaker window: %v", err)
+	}
+	if _, err := ParseOptionalDuration(cb.OpenDuration); err != nil {
+		return fmt.Errorf("invalid circuit breaker openDuration: %v", err)
+	}
+	return nil
+}
+
+func (od OutlierDetectionConfig) validate() error {
+	if od.MaxEjectionPercent < 0 || od.MaxEjectionPercent > 100 {
+		return fmt.Errorf("outlier detection maxEjectionPercent must be between 0 and 100")
+	}
+	if od.SuccessRateRequestVolume < 0 || od.SuccessRateStdevFactor < 0 {
+		return fmt.Errorf("outlier detection success rate settings must not be negative")
+	}
+	durations := map[string]string{
+		"interval":              od.Interval,
+		"baseEjectionTime":      od.BaseEjectionTime,
+		"maxEjectionTime":       od.MaxEjectionTime,
+		"slowResponseThreshold": od.SlowResponseThreshold,
+	}
+	for name, value := range durations {
+		if d, err := ParseOptionalDuration(value); err != nil || d < 0 {
+			return fmt.Errorf("invalid outlier detection %s %q", name, value)
+		}
+	}
+	return nil
+}
+
+func (t TransportConfig) validate() error {
+	if t.MaxIdleConnsPerHost < 0 {
+		return fmt.Errorf("transport maxIdleConnsPerHost must not be negative")
+	}
+	timeouts := map[string]string{
+		"idleConnTimeout":       t.IdleConnTimeout,
+		"dialTimeout":           t.DialTimeout,
+		"responseHeaderTimeout": t.ResponseHeaderTimeout,
+		"tlsHandshakeTimeout":   t.TLSHandshakeTimeout,
+	}
+	for name, value := range timeouts {
+		d, err := ParseOptionalDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid transport %s: %v", name, err)
+		}
+		if d < 0 {
+			return fmt.Errorf("transport %s must not be negative", name)
+		}
+	}
+	if _, err := ParseOptionalDuration(t.KeepAlive); err != nil {
+		return fmt.Errorf("invalid transport keepAlive: %v", err)
+	}
+	return nil
+}
+
+func (t TLSConfig) validate(port int, adminPort int) error {
+	if t.Port == 0 {
+		if t.RedirectHTTP {
+			return fmt.Errorf("tls redirectHTTP requires a tls port")
+		}
+		return nil
+	}
+	if t.Port < 0 || t.Port > 65535 {
+		return fmt.Errorf("invalid tls port: %d", t.Port)
+	}
+	if t.Port == port || t.Port == adminPort {
+		return fmt.Errorf("tls port must differ from the load balancer and admin ports")
+	}
+	if len(t.Certificates) == 0 {
+		return fmt.Errorf("tls requires at least one certificate")
+	}
+	for i, cert := range t.Certificates {
+		if cert.CertFile == "" || cert.KeyFile == "" {
+			return fmt.Errorf("tls certificate %d needs both certFile and keyFile", i)
+		}
+	}
+	if _, err := tlsutil.ParseVersion(t.MinVersion); err != nil {
+		return fmt.Errorf("invalid tls minVersion: %v", err)
+	}
+	if _, err := tlsutil.ParseCipherSuites(t.CipherSuites); err != nil {
+		return fmt.Errorf("invalid tls cipherSuites: %v", err)
+	}
+	if _, err := ParseOptionalDuration(t.CertReloadInterval); err != nil {
+		return fmt.Errorf("invalid tls certReloadInterval: %v", err)
+	}
+	return nil
+}
+
+// an empty string means "not set" and parses to 0
+func ParseOptionalDuration(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(value)
+}
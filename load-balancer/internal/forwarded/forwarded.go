@@ -0,0 +1,233 @@
+package forwarded
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/lokeshllkumar/load-balancer/internal/netutil"
+)
+
+// resolves the real client of every request from the Forwarded or X-Forwarded-For chain, believing
+// only the hops added by trusted proxies; the result is read back with ClientIP
+type Handler struct {
+	trusted []*net.IPNet
+	next    http.Handler
+}
+
+func NewHandler(trusted []*net.IPNet, next http.Handler) *Handler {
+	return &Handler{trusted: trusted, next: next}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	peer := remoteIP(r.RemoteAddr)
+	peerTrusted := peer != nil && netutil.ContainsIP(h.trusted, peer)
+
+	clientIP := hostOnly(r.RemoteAddr)
+	if peerTrusted {
+		clientIP = h.resolveClient(r, clientIP)
+	}
+
+	ctx := context.WithValue(r.Context(), clientKey{}, client{ip: clientIP, peerTrusted: peerTrusted})
+	h.next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// unexported, so no other package can collide with it
+type clientKey struct{}
+
+// what Handler found out about a request's origin
+type client struct {
+	ip          string
+	peerTrusted bool // the connection came from a trusted proxy
+}
+
+// walks the chain from the nearest hop outwards and stops at the first address no trusted proxy vouches for
+func (h *Handler) resolveClient(r *http.Request, peer string) string {
+	chain := forwardedFor(r.Header.Values("Forwarded"))
+	if len(chain) == 0 {
+		chain = xForwardedFor(r.Header.Values("X-Forwarded-For"))
+	}
+
+	client := peer
+	for i := len(chain) - 1; i >= 0; i-- {
+		ip := net.ParseIP(chain[i])
+		if ip == nil {
+			// obfuscated or "unknown"; the nearest known hop is as close to the client as can be told
+			break
+		}
+		client = ip.String()
+		if !netutil.ContainsIP(h.trusted, ip) {
+			break
+		}
+	}
+	return client
+}
+
+// the IP of the client that sent the request: the one resolved by Handler, or the connection's peer
+// for requests that did not pass through it (such as the stand-ins used for TCP and UDP balancing)
+func ClientIP(r *http.Request) string {
+	if c, ok := r.Context().Value(clientKey{}).(client); ok {
+		return c.ip
+	}
+	return hostOnly(r.RemoteAddr)
+}
+
+// sets the forwarding headers on a request about to be proxied; chains from trusted proxies are extended,
+// anything a client sent directly is replaced so it cannot spoof its origin
+func SetHeaders(out http.Header, in *http.Request) {
+	c, _ := in.Context().Value(clientKey{}).(client)
+	peerTrusted := c.peerTrusted
+	peer := hostOnly(in.RemoteAddr)
+	proto := "http"
+	if in.TLS != nil {
+		proto = "https"
+	}
+	port := ""
+	if localAddr, ok := in.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+		if _, p, err := net.SplitHostPort(localAddr.String()); err == nil {
+			port = p
+		}
+	}
+
+	element := "for=" + quoteNode(peer)
+	if in.Host != "" {
+		element += ";host=" + quoteValue(in.Host)
+	}
+	element += ";proto=" + proto
+
+	xff := peer
+	if peerTrusted {
+		if prior := strings.Join(in.Header.Values("X-Forwarded-For"), ", "); prior != "" {
+			xff = prior + ", " + peer
+		}
+		if prior := strings.Join(in.Header.Values("Forwarded"), ", "); prior != "" {
+			element = prior + ", " + element
+		}
+	}
+	out.Set("X-Forwarded-For", xff)
+	out.Set("Forwarded", element)
+
+	// the original scheme, host and port are kept when a trusted proxy already recorded them
+	setFirstHop(out, in, peerTrusted, "X-Forwarded-Proto", proto)
+	setFirstHop(out, in, peerTrusted, "X-Forwarded-Host", in.Host)
+	setFirstHop(out, in, peerTrusted, "X-Forwarded-Port", port)
+}
+
+func setFirstHop(out http.Header, in *http.Request, peerTrusted bool, name string, value string) {
+	if peerTrusted {
+		if prior := in.Header.Get(name); prior != "" {
+			out.Set(name, prior)
+			return
+		}
+	}
+	if value == "" {
+		out.Del(name)
+		return
+	}
+	out.Set(name, value)
+}
+
+// the "for" parameters of RFC 7239 Forwarded headers, in order; commas and semicolons
+// inside quoted values, such as a quoted host, separate nothing
+func forwardedFor(headers []string) []string {
+	var chain []string
+	for _, header := range headers {
+		for _, element := range splitUnquoted(header, ',') {
+			for _, pair := range splitUnquoted(element, ';') {
+				key, value, found := strings.Cut(strings.TrimSpace(pair), "=")
+				if !found || !strings.EqualFold(strings.TrimSpace(key), "for") {
+					continue
+				}
+				chain = append(chain, hostOnly(unquote(strings.TrimSpace(value))))
+			}
+		}
+	}
+	return chain
+}
+
+// splits s at every sep outside a quoted string
+func splitUnquoted(s string, sep byte) []string {
+	var parts []string
+	quoted, escaped := false, false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case escaped:
+			escaped = false
+		case quoted && c == '\\':
+			escaped = true
+		case c == '"':
+			quoted = !quoted
+		case c == sep && !quoted:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// strips the quotes and backslash escapes of a quoted string, tokens are returned as they are
+func unquote(value string) string {
+	if len(value) < 2 || value[0] != '"' || value[len(value)-1] != '"' {
+		return value
+	}
+	var b strings.Builder
+	for i := 1; i < len(value)-1; i++ {
+		if value[i] == '\\' && i+1 < len(value)-1 {
+			i++
+		}
+		b.WriteByte(value[i])
+	}
+	return b.String()
+}
+
+func xForwardedFor(headers []string) []string {
+	var chain []string
+	for _, header := range headers {
+		for _, hop := range strings.Split(header, ",") {
+			if hop = strings.TrimSpace(hop); hop != "" {
+				chain = append(chain, hostOnly(hop))
+			}
+		}
+	}
+	return chain
+}
+
+// strips the port and IPv6 brackets from an address, leaving anything unparsable as it is
+func hostOnly(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return strings.Trim(addr, "[]")
+}
+
+func remoteIP(remoteAddr string) net.IP {
+	return net.ParseIP(hostOnly(remoteAddr))
+}
+
+// IPv6 nodes are bracketed and quoted as RFC 7239 requires
+func quoteNode(ip string) string {
+	if strings.Contains(ip, ":") {
+		return strconv.Quote("[" + ip + "]")
+	}
+	return ip
+}
+
+// values outside the token character set, such as a host with a port, must be quoted
+func quoteValue(value string) string {
+	for _, c := range value {
+		if !isTokenChar(c) {
+			return strconv.Quote(value)
+		}
+	}
+	return value
+}
+
+func isTokenChar(c rune) bool {
+	if c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' {
+		return true
+	}
+	return strings.ContainsRune("!#$%&'*+-.^_`|~", c)
+}
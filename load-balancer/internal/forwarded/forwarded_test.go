@@ -0,0 +1,169 @@
+package forwarded
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/lokeshllkumar/load-balancer/internal/netutil"
+)
+
+func TestForwardedFor(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers []string
+		want    []string
+	}{
+		{"single element", []string{"for=192.0.2.60;proto=http;by=203.0.113.43"}, []string{"192.0.2.60"}},
+		{"several elements", []string{"for=192.0.2.43, for=198.51.100.17"}, []string{"192.0.2.43", "198.51.100.17"}},
+		{"several headers", []string{"for=192.0.2.43", "for=198.51.100.17"}, []string{"192.0.2.43", "198.51.100.17"}},
+		{"quoted IPv6 with port", []string{`for="[2001:db8::1]:80"`}, []string{"2001:db8::1"}},
+		{"quoted IPv4 with port", []string{`for="192.0.2.43:4711"`}, []string{"192.0.2.43"}},
+		{"case insensitive key", []string{"For=192.0.2.43"}, []string{"192.0.2.43"}},
+		{"comma inside a quoted host", []string{`host="a.example,b.example";for=192.0.2.43, for=198.51.100.17`}, []string{"192.0.2.43", "198.51.100.17"}},
+		{"semicolon inside a quoted host", []string{`host="a.example;for=10.0.0.1";for=192.0.2.43`}, []string{"192.0.2.43"}},
+		{"escaped quote", []string{`host="a\"b,c";for=192.0.2.43`}, []string{"192.0.2.43"}},
+		{"obfuscated and unknown", []string{`for=_hidden, for="unknown"`}, []string{"_hidden", "unknown"}},
+		{"no for parameter", []string{"proto=https;host=example.com"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := forwardedFor(tt.headers); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("forwardedFor(%q) = %q, want %q", tt.headers, got, tt.want)
+			}
+		})
+	}
+}
+
+// runs a request through a Handler trusting 10.0.0.0/8 and returns it as the next handler saw it
+func serveTrusting10(t *testing.T, remoteAddr string, headers map[string]string) *http.Request {
+	trusted, err := netutil.ParseCIDRs([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "http://lb.example.com/orders", nil)
+	req.RemoteAddr = remoteAddr
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	var seen *http.Request
+	NewHandler(trusted, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = r
+	})).ServeHTTP(httptest.NewRecorder(), req)
+	return seen
+}
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		want       string
+	}{
+		{
+			name:       "untrusted peer cannot claim another address",
+			remoteAddr: "198.51.100.9:4000",
+			headers:    map[string]string{"X-Forwarded-For": "203.0.113.7", "Forwarded": "for=203.0.113.7"},
+			want:       "198.51.100.9",
+		},
+		{
+			name:       "trusted peer vouches for the client",
+			remoteAddr: "10.0.0.1:4000",
+			headers:    map[string]string{"X-Forwarded-For": "203.0.113.7"},
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "trusted hops are walked over",
+			remoteAddr: "10.0.0.1:4000",
+			headers:    map[string]string{"X-Forwarded-For": "203.0.113.7, 10.0.0.2, 10.0.0.3"},
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "hops before the first untrusted one are ignored",
+			remoteAddr: "10.0.0.1:4000",
+			headers:    map[string]string{"X-Forwarded-For": "192.0.2.1, 203.0.113.7, 10.0.0.2"},
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "Forwarded is preferred",
+			remoteAddr: "10.0.0.1:4000",
+			headers:    map[string]string{"X-Forwarded-For": "192.0.2.1", "Forwarded": `for="[2001:db8::1]:80";host="a.example,b.example", for=10.0.0.2`},
+			want:       "2001:db8::1",
+		},
+		{
+			name:       "unknown nearest hop leaves the peer",
+			remoteAddr: "10.0.0.1:4000",
+			headers:    map[string]string{"Forwarded": "for=203.0.113.7, for=unknown"},
+			want:       "10.0.0.1",
+		},
+		{
+			name:       "only trusted hops",
+			remoteAddr: "10.0.0.1:4000",
+			headers:    map[string]string{"X-Forwarded-For": "10.0.0.3, 10.0.0.2"},
+			want:       "10.0.0.3",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ClientIP(serveTrusting10(t, tt.remoteAddr, tt.headers)); got != tt.want {
+				t.Fatalf("ClientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetHeaders(t *testing.T) {
+	prior := map[string]string{
+		"X-Forwarded-For":   "203.0.113.7",
+		"Forwarded":         "for=203.0.113.7",
+		"X-Forwarded-Proto": "https",
+	}
+	tests := []struct {
+		name       string
+		remoteAddr string
+		want       map[string]string
+	}{
+		{
+			name:       "trusted chain is extended",
+			remoteAddr: "10.0.0.1:4000",
+			want: map[string]string{
+				"X-Forwarded-For":   "203.0.113.7, 10.0.0.1",
+				"Forwarded":         "for=203.0.113.7, for=10.0.0.1;host=lb.example.com;proto=http",
+				"X-Forwarded-Proto": "https",
+				"X-Forwarded-Host":  "lb.example.com",
+			},
+		},
+		{
+			name:       "untrusted chain is replaced",
+			remoteAddr: "198.51.100.9:4000",
+			want: map[string]string{
+				"X-Forwarded-For":   "198.51.100.9",
+				"Forwarded":         "for=198.51.100.9;host=lb.example.com;proto=http",
+				"X-Forwarded-Proto": "http",
+				"X-Forwarded-Host":  "lb.example.com",
+			},
+		},
+		{
+			name:       "IPv6 peers are quoted",
+			remoteAddr: "[2001:db8::9]:4000",
+			want: map[string]string{
+				"X-Forwarded-For": "2001:db8::9",
+				"Forwarded":       `for="[2001:db8::9]";host=lb.example.com;proto=http`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := serveTrusting10(t, tt.remoteAddr, prior)
+			out := in.Header.Clone()
+			SetHeaders(out, in)
+			for name, want := range tt.want {
+				if got := out.Get(name); got != want {
+					t.Errorf("%s = %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package healthcheck
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/url"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// grpc.health.v1 check; https:// backends are reached over TLS, the rest in plaintext.
+// each backend keeps one connection across probes, closed by Forget once it leaves the pool
+type GRPCChecker struct {
+	Service   string      // overridden per instance by the healthCheckGrpcService metadata
+	TLSConfig *tls.Config // nil uses the system roots
+
+	mu    sync.Mutex
+	conns map[string]*grpc.ClientConn // by connKey
+}
+
+func (c *GRPCChecker) Type() string {
+	return TypeGRPC
+}
+
+func (c *GRPCChecker) Check(ctx context.Context, target Target) error {
+	conn, err := c.conn(target.URL)
+	if err != nil {
+		return err
+	}
+
+	service := c.Service
+	if override, found := target.Metadata[MetadataGRPCService]; found {
+		service = override
+	}
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: service})
+	if err != nil {
+		return err
+	}
+	if resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		return fmt.Errorf("gRPC health status %s", resp.GetStatus())
+	}
+	return nil
+}
+
+// the scheme decides between TLS and plaintext, so it is part of the key
+func connKey(u *url.URL) string {
+	return u.Scheme + "://" + hostPort(u)
+}
+
+// the backend's cached connection, created on its first probe
+func (c *GRPCChecker) conn(u *url.URL) (*grpc.ClientConn, error) {
+	key := connKey(u)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if conn, found := c.conns[key]; found {
+		// every probe gets to dial again, instead of failing fast while gRPC backs off for up to two minutes
+		if conn.GetState() == connectivity.TransientFailure {
+			conn.ResetConnectBackoff()
+		}
+		return conn, nil
+	}
+
+	creds := insecure.NewCredentials()
+	if u.Scheme == "https" {
+		creds = credentials.NewTLS(c.TLSConfig)
+	}
+	conn, err := grpc.NewClient(hostPort(u), grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, err
+	}
+	if c.conns == nil {
+		c.conns = make(map[string]*grpc.ClientConn)
+	}
+	c.conns[key] = conn
+	return conn, nil
+}
+
+// closes the connection kept for a backend that is no longer probed
+func (c *GRPCChecker) Forget(u *url.URL) {
+	c.mu.Lock()
+	conn, found := c.conns[connKey(u)]
+	delete(c.conns, connKey(u))
+	c.mu.Unlock()
+	if found {
+		conn.Close()
+	}
+}
+
+// closes every cached connection
+func (c *GRPCChecker) Close() {
+	c.mu.Lock()
+	conns := c.conns
+	c.conns = nil
+	c.mu.Unlock()
+	for _, conn := range conns {
+		conn.Close()
+	}
+}
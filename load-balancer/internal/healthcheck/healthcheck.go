@@ -1,26 +1,129 @@
 package healthcheck
 
 import (
-	"log"
+	"context"
+	"net"
 	"net/http"
-	"time"
+	"net/url"
+	"strings"
 )
 
-// HTTP GET check
-func CheckHTTP(url string, timeout time.Duration) bool {
-	client := http.Client{
-		Timeout: timeout,
+const (
+	TypeHTTP = "http"
+	TypeTCP  = "tcp"
+	TypeGRPC = "grpc"
+
+	// registry metadata keys that override the configured check for a single instance
+	MetadataType        = "healthCheckType"
+	MetadataGRPCService = "healthCheckGrpcService"
+)
+
+// the backend being probed
+type Target struct {
+	URL        *url.URL
+	HealthPath string
+	Metadata   map[string]string
+}
+
+// a single probe; a nil error means the backend is healthy, the deadline comes from ctx
+type HealthChecker interface {
+	Check(ctx context.Context, target Target) error
+	Type() string
+}
+
+type Options struct {
+	Type        string // http, tcp or grpc; unset checks tcp:// backends over TCP and the rest over HTTP
+	HTTP        HTTPOptions
+	GRPCService string // service name sent in grpc.health.v1 requests, empty asks about the server as a whole
+}
+
+// one checker of each type, shared by every backend of a pool; probes go over the given transport,
+// kept apart from the one carrying traffic so https:// backends are verified the same way without competing for its connections
+type Checkers struct {
+	defaultType string
+	http        *HTTPChecker
+	tcp         TCPChecker
+	grpc        *GRPCChecker
+}
+
+func NewCheckers(options Options, transport *http.Transport) *Checkers {
+	grpcChecker := &GRPCChecker{Service: options.GRPCService}
+	var roundTripper http.RoundTripper
+	if transport != nil {
+		roundTripper = transport
+		grpcChecker.TLSConfig = transport.TLSClientConfig
+	}
+	return &Checkers{
+		defaultType: options.Type,
+		http:        NewHTTPChecker(options.HTTP, roundTripper),
+		grpc:        grpcChecker,
+	}
+}
+
+// the instance's registry metadata wins over the configured type, which wins over the URL scheme;
+// udp:// backends have nothing to connect to and get no checker
+func (c *Checkers) For(backendURL *url.URL, metadata map[string]string) HealthChecker {
+	if backendURL.Scheme == "udp" {
+		return nil
+	}
+	checkType := strings.ToLower(metadata[MetadataType])
+	if checkType == "" {
+		checkType = c.defaultType
 	}
-	resp, err := client.Get(url)
+	if checkType == "" && backendURL.Scheme == "tcp" {
+		checkType = TypeTCP
+	}
+	switch checkType {
+	case TypeTCP:
+		return c.tcp
+	case TypeGRPC:
+		return c.grpc
+	}
+	return c.http
+}
+
+// releases what is kept for a backend between probes, once it has left the pool
+func (c *Checkers) Forget(backendURL *url.URL) {
+	c.grpc.Forget(backendURL)
+}
+
+// releases what is kept for every backend, once the checkers are replaced or the pool stops
+func (c *Checkers) Close() {
+	c.grpc.Close()
+}
+
+func ValidType(checkType string) bool {
+	switch checkType {
+	case "", TypeHTTP, TypeTCP, TypeGRPC:
+		return true
+	}
+	return false
+}
+
+// connect-only check for backends that do not speak HTTP
+type TCPChecker struct{}
+
+func (TCPChecker) Type() string {
+	return TypeTCP
+}
+
+func (TCPChecker) Check(ctx context.Context, target Target) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", hostPort(target.URL))
 	if err != nil {
-		log.Printf("Health check for %s failed: %v", url, err)
-		return false
+		return err
 	}
-	defer resp.Body.Close()
+	conn.Close()
+	return nil
+}
 
-	if resp.StatusCode != http.StatusOK {
-		log.Printf("Health check for %s returned HTTP status code: %d", url, resp.StatusCode)
-		return false
+// the URL's host with the scheme's default port when it names none
+func hostPort(u *url.URL) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	if u.Scheme == "https" {
+		return net.JoinHostPort(u.Hostname(), "443")
 	}
-	return true
-}
\ No newline at end of file
+	return net.JoinHostPort(u.Hostname(), "80")
+}
@@ -0,0 +1,161 @@
+package healthcheck
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// only this much of the body is read when matching it
+const maxBodyBytes = 64 * 1024
+
+type HTTPOptions struct {
+	Method           string // defaults to GET
+	Headers          map[string]string
+	Host             string        // Host header, defaults to the backend's
+	ExpectedStatuses []StatusRange // defaults to 200 only
+	BodyRegex        *regexp.Regexp
+	JSONField        string // dot-separated path into a JSON body, e.g. status or checks.db.status
+	JSONValue        string // compared with the field's value printed as text
+}
+
+// inclusive range of accepted status codes
+type StatusRange struct {
+	Min int
+	Max int
+}
+
+// parses codes such as "200", "200-299" or "2xx"
+func ParseStatusRanges(specs []string) ([]StatusRange, error) {
+	ranges := make([]StatusRange, 0, len(specs))
+	for _, spec := range specs {
+		spec = strings.TrimSpace(spec)
+		var r StatusRange
+		var err error
+		switch {
+		case len(spec) == 3 && strings.HasSuffix(strings.ToLower(spec), "xx"):
+			var class int
+			class, err = strconv.Atoi(spec[:1])
+			r = StatusRange{Min: class * 100, Max: class*100 + 99}
+		case strings.Contains(spec, "-"):
+			low, high, _ := strings.Cut(spec, "-")
+			r.Min, err = strconv.Atoi(strings.TrimSpace(low))
+			if err == nil {
+				r.Max, err = strconv.Atoi(strings.TrimSpace(high))
+			}
+		default:
+			r.Min, err = strconv.Atoi(spec)
+			r.Max = r.Min
+		}
+		if err != nil || r.Min < 100 || r.Max > 599 || r.Min > r.Max {
+			return nil, fmt.Errorf("invalid status range %q", spec)
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges, nil
+}
+
+type HTTPChecker struct {
+	options HTTPOptions
+	client  *http.Client
+}
+
+// a nil transport uses http.DefaultTransport
+func NewHTTPChecker(options HTTPOptions, transport http.RoundTripper) *HTTPChecker {
+	if options.Method == "" {
+		options.Method = http.MethodGet
+	}
+	if len(options.ExpectedStatuses) == 0 {
+		options.ExpectedStatuses = []StatusRange{{Min: http.StatusOK, Max: http.StatusOK}}
+	}
+	return &HTTPChecker{
+		options: options,
+		client: &http.Client{
+			Transport: transport,
+			// a redirect is an answer of its own, matched against the expected statuses
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+func (c *HTTPChecker) Type() string {
+	return TypeHTTP
+}
+
+func (c *HTTPChecker) Check(ctx context.Context, target Target) error {
+	req, err := http.NewRequestWithContext(ctx, c.options.Method, target.URL.String()+target.HealthPath, nil)
+	if err != nil {
+		return err
+	}
+	for name, value := range c.options.Headers {
+		req.Header.Set(name, value)
+	}
+	if c.options.Host != "" {
+		req.Host = c.options.Host
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// a body read to the end lets the connection go back to the shared transport's idle pool
+		io.Copy(io.Discard, io.LimitReader(resp.Body, maxBodyBytes))
+		resp.Body.Close()
+	}()
+
+	if !c.statusExpected(resp.StatusCode) {
+		return fmt.Errorf("unexpected HTTP status code: %d", resp.StatusCode)
+	}
+	if c.options.BodyRegex == nil && c.options.JSONField == "" {
+		return nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBodyBytes))
+	if err != nil {
+		return fmt.Errorf("failed to read body: %w", err)
+	}
+	if c.options.BodyRegex != nil && !c.options.BodyRegex.Match(body) {
+		return fmt.Errorf("body does not match %q", c.options.BodyRegex.String())
+	}
+	if c.options.JSONField != "" {
+		return matchJSONField(body, c.options.JSONField, c.options.JSONValue)
+	}
+	return nil
+}
+
+func (c *HTTPChecker) statusExpected(status int) bool {
+	for _, r := range c.options.ExpectedStatuses {
+		if status >= r.Min && status <= r.Max {
+			return true
+		}
+	}
+	return false
+}
+
+func matchJSONField(body []byte, path string, expected string) error {
+	var value any
+	if err := json.Unmarshal(body, &value); err != nil {
+		return fmt.Errorf("body is not JSON: %w", err)
+	}
+	for _, key := range strings.Split(path, ".") {
+		object, ok := value.(map[string]any)
+		if !ok {
+			return fmt.Errorf("JSON field %q not found", path)
+		}
+		if value, ok = object[key]; !ok {
+			return fmt.Errorf("JSON field %q not found", path)
+		}
+	}
+	if actual := fmt.Sprint(value); actual != expected {
+		return fmt.Errorf("JSON field %q is %q, expected %q", path, actual, expected)
+	}
+	return nil
+}
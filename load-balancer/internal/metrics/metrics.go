@@ -1,8 +1,10 @@
 package metrics
 
 import (
+	"bufio"
 	"context"
 	"fmt"
+	"net"
 	"net/http"
 	"time"
 
@@ -40,7 +42,122 @@ var BackendStatusGauge = prometheus.NewGaugeVec(
 var ActiveConnectionsGauge = prometheus.NewGaugeVec(
 	prometheus.GaugeOpts{
 		Name: "loadbalancer_backend_active_connections",
-		Help: "Number of active connections to each backend service",
+		Help: "Number of active request/response connections to each backend service",
+	},
+	[]string{"backend_host", "backend_id"},
+)
+
+// upgraded (WebSocket) connections and event streams, kept apart so they do not skew the request/response count
+var LongLivedConnectionsGauge = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "loadbalancer_backend_long_lived_connections",
+		Help: "Number of upgraded connections and event streams open to each backend service",
+	},
+	[]string{"backend_host", "backend_id"},
+)
+
+var CircuitBreakerStateGauge = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "loadbalancer_backend_circuit_state",
+		Help: "Current circuit breaker state of backend services(0:closed, 1:open, 2:half-open)",
+	},
+	[]string{"backend_host", "backend_id"},
+)
+
+var CircuitBreakerTransitions = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "loadbalancer_backend_circuit_transitions_total",
+		Help: "Total number of circuit breaker state changes per backend service",
+	},
+	[]string{"backend_host", "backend_id", "from", "to"},
+)
+
+var RetriesTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "loadbalancer_retries_total",
+		Help: "Total number of retry decisions made by the proxy(retried, budget_exhausted)",
+	},
+	[]string{"result"},
+)
+
+var TCPConnectionsTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "loadbalancer_tcp_connections_total",
+		Help: "Total number of connections accepted by TCP listeners(proxied, no_backend, connect_failed)",
+	},
+	[]string{"listener", "result"},
+)
+
+var TCPBytesTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "loadbalancer_tcp_bytes_total",
+		Help: "Total number of bytes spliced by TCP listeners(direction: upstream, downstream)",
+	},
+	[]string{"listener", "backend_id", "direction"},
+)
+
+var UDPDatagramsTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "loadbalancer_udp_datagrams_total",
+		Help: "Total number of datagrams forwarded by UDP listeners per backend(direction: upstream, downstream)",
+	},
+	[]string{"listener", "backend_id", "direction"},
+)
+
+var UDPBytesTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "loadbalancer_udp_bytes_total",
+		Help: "Total number of bytes forwarded by UDP listeners per backend(direction: upstream, downstream)",
+	},
+	[]string{"listener", "backend_id", "direction"},
+)
+
+var UDPSessionsRejectedTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "loadbalancer_udp_sessions_rejected_total",
+		Help: "Total number of datagrams from new clients dropped because a UDP listener had reached its session limit",
+	},
+	[]string{"listener"},
+)
+
+var RateLimitRequestsTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "loadbalancer_rate_limit_requests_total",
+		Help: "Total number of requests checked against route rate limits(allowed, rejected)",
+	},
+	[]string{"route", "result"},
+)
+
+var RateLimitKeysGauge = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "loadbalancer_rate_limit_keys",
+		Help: "Number of rate limit buckets currently tracked per route",
+	},
+	[]string{"route"},
+)
+
+// probe latency by outcome, so its count also gives the number of successes and failures
+var HealthCheckDuration = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name:    "loadbalancer_health_check_duration_seconds",
+		Help:    "Duration of backend health checks(type: http, tcp, grpc; result: success, failure)",
+		Buckets: prometheus.DefBuckets,
+	},
+	[]string{"backend_host", "backend_id", "type", "result"},
+)
+
+var OutlierEjectionsTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "loadbalancer_outlier_ejections_total",
+		Help: "Total number of backends ejected by outlier detection(reason: consecutive_5xx, consecutive_gateway_failure, success_rate)",
+	},
+	[]string{"backend_host", "backend_id", "reason"},
+)
+
+var OutlierEjectedGauge = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "loadbalancer_backend_outlier_ejected",
+		Help: "Whether a backend is currently ejected by outlier detection(0:no, 1:yes)",
 	},
 	[]string{"backend_host", "backend_id"},
 )
@@ -50,28 +167,64 @@ func InitMetrics() {
 	prometheus.MustRegister(TotalRequests)
 	prometheus.MustRegister(BackendStatusGauge)
 	prometheus.MustRegister(ActiveConnectionsGauge)
+	prometheus.MustRegister(LongLivedConnectionsGauge)
+	prometheus.MustRegister(CircuitBreakerStateGauge)
+	prometheus.MustRegister(CircuitBreakerTransitions)
+	prometheus.MustRegister(RetriesTotal)
+	prometheus.MustRegister(TCPConnectionsTotal)
+	prometheus.MustRegister(TCPBytesTotal)
+	prometheus.MustRegister(UDPDatagramsTotal)
+	prometheus.MustRegister(UDPBytesTotal)
+	prometheus.MustRegister(UDPSessionsRejectedTotal)
+	prometheus.MustRegister(RateLimitRequestsTotal)
+	prometheus.MustRegister(RateLimitKeysGauge)
+	prometheus.MustRegister(HealthCheckDuration)
+	prometheus.MustRegister(OutlierEjectionsTotal)
+	prometheus.MustRegister(OutlierEjectedGauge)
 
 	http.Handle("/metrics", promhttp.Handler())
 }
 
+// unexported, so no other package can collide with it
+type requestLabelsKey struct{}
+
+// filled in by the proxy while it handles a request, read once the response is written
+type requestLabels struct {
+	backendID string
+	strategy  string
+}
+
+// records the strategy picking the backend for a request passing through PrometheusMiddleware
+func SetStrategy(ctx context.Context, strategy string) {
+	if labels, ok := ctx.Value(requestLabelsKey{}).(*requestLabels); ok {
+		labels.strategy = strategy
+	}
+}
+
+// records the backend a request passing through PrometheusMiddleware was sent to; on retries the last one counts
+func SetBackend(ctx context.Context, backendID string) {
+	if labels, ok := ctx.Value(requestLabelsKey{}).(*requestLabels); ok {
+		labels.backendID = backendID
+	}
+}
+
 func PrometheusMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 		wrappedWriter := &responseWriter{ResponseWriter: w}
 
-		ctx := context.WithValue(r.Context(), "responseWriter", wrappedWriter)
+		// backend ID and strategy used are set by the proxy, requests it never sees keep these
+		labels := &requestLabels{backendID: "none", strategy: "none"}
+		ctx := context.WithValue(r.Context(), requestLabelsKey{}, labels)
 		r = r.WithContext(ctx)
 
 		next.ServeHTTP(wrappedWriter, r)
 
 		duration := time.Since(start).Seconds()
 		status := wrappedWriter.Status()
-		// backend ID and strategy to be used are set by the proxy
-		backendID := r.Context().Value("backend_id")
-		strategyUsed := r.Context().Value("strategy_used")
 
-		RequestDuration.WithLabelValues(r.URL.Path, r.Method, fmt.Sprintf("%d", status), fmt.Sprintf("%v", backendID), fmt.Sprintf("%v", strategyUsed)).Observe(duration)
-		TotalRequests.WithLabelValues(r.URL.Path, r.Method, fmt.Sprintf("%d", status), fmt.Sprintf("%v", backendID), fmt.Sprintf("%v", strategyUsed)).Inc()
+		RequestDuration.WithLabelValues(r.URL.Path, r.Method, fmt.Sprintf("%d", status), labels.backendID, labels.strategy).Observe(duration)
+		TotalRequests.WithLabelValues(r.URL.Path, r.Method, fmt.Sprintf("%d", status), labels.backendID, labels.strategy).Inc()
 	})
 }
 
@@ -94,6 +247,30 @@ func (rw *responseWriter) Write(data []byte) (int, error) {
 	return rw.ResponseWriter.Write(data)
 }
 
+// lets the proxy stream responses through the wrapper
+func (rw *responseWriter) Flush() {
+	if flusher, ok := rw.ResponseWriter.(http.Flusher); ok {
+		if rw.statusCode == 0 {
+			rw.statusCode = http.StatusOK
+		}
+		flusher.Flush()
+	}
+}
+
+// lets the proxy take over the client connection for protocol upgrades
+func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := rw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("underlying response writer does not support hijacking")
+	}
+	return hijacker.Hijack()
+}
+
+// for http.ResponseController
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
 func (rw *responseWriter) Status() int {
 	if rw.statusCode == 0 {
 		return http.StatusOK
@@ -21,6 +21,61 @@ const (
 	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
 )
 
+type ServiceEvent_Type int32
+
+const (
+	ServiceEvent_UNSPECIFIED ServiceEvent_Type = 0
+	ServiceEvent_ADDED       ServiceEvent_Type = 1
+	ServiceEvent_UPDATED     ServiceEvent_Type = 2
+	ServiceEvent_REMOVED     ServiceEvent_Type = 3
+	ServiceEvent_SYNCED      ServiceEvent_Type = 4 // sent once every instance healthy at the start of the watch has been sent as ADDED
+)
+
+// Enum value maps for ServiceEvent_Type.
+var (
+	ServiceEvent_Type_name = map[int32]string{
+		0: "UNSPECIFIED",
+		1: "ADDED",
+		2: "UPDATED",
+		3: "REMOVED",
+		4: "SYNCED",
+	}
+	ServiceEvent_Type_value = map[string]int32{
+		"UNSPECIFIED": 0,
+		"ADDED":       1,
+		"UPDATED":     2,
+		"REMOVED":     3,
+		"SYNCED":      4,
+	}
+)
+
+func (x ServiceEvent_Type) Enum() *ServiceEvent_Type {
+	p := new(ServiceEvent_Type)
+	*p = x
+	return p
+}
+
+func (x ServiceEvent_Type) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (ServiceEvent_Type) Descriptor() protoreflect.EnumDescriptor {
+	return file_service_registry_proto_enumTypes[0].Descriptor()
+}
+
+func (ServiceEvent_Type) Type() protoreflect.EnumType {
+	return &file_service_registry_proto_enumTypes[0]
+}
+
+func (x ServiceEvent_Type) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use ServiceEvent_Type.Descriptor instead.
+func (ServiceEvent_Type) EnumDescriptor() ([]byte, []int) {
+	return file_service_registry_proto_rawDescGZIP(), []int{4, 0}
+}
+
 // ServiceInstance message definition for gRPC
 type GrpcServiceInstance struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
@@ -30,6 +85,8 @@ type GrpcServiceInstance struct {
 	Port          int32                  `protobuf:"varint,4,opt,name=port,proto3" json:"port,omitempty"`
 	Url           string                 `protobuf:"bytes,5,opt,name=url,proto3" json:"url,omitempty"`
 	HealthPath    string                 `protobuf:"bytes,6,opt,name=healthPath,proto3" json:"healthPath,omitempty"`
+	Weight        int32                  `protobuf:"varint,7,opt,name=weight,proto3" json:"weight,omitempty"`                                                                              // relative share of traffic for weighted strategies, 0 when unset
+	Metadata      map[string]string      `protobuf:"bytes,8,rep,name=metadata,proto3" json:"metadata,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"` // free-form instance details, e.g. healthCheckType to pick how the load balancer probes it
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -106,6 +163,20 @@ func (x *GrpcServiceInstance) GetHealthPath() string {
 	return ""
 }
 
+func (x *GrpcServiceInstance) GetWeight() int32 {
+	if x != nil {
+		return x.Weight
+	}
+	return 0
+}
+
+func (x *GrpcServiceInstance) GetMetadata() map[string]string {
+	if x != nil {
+		return x.Metadata
+	}
+	return nil
+}
+
 // Request message for GetHealthyServices
 type GetHealthyServicesRequest struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
@@ -188,6 +259,96 @@ func (x *GetHealthyServicesResponse) GetServices() []*GrpcServiceInstance {
 	return nil
 }
 
+// Request message for WatchServices
+type WatchServicesRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchServicesRequest) Reset() {
+	*x = WatchServicesRequest{}
+	mi := &file_service_registry_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchServicesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchServicesRequest) ProtoMessage() {}
+
+func (x *WatchServicesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_service_registry_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchServicesRequest.ProtoReflect.Descriptor instead.
+func (*WatchServicesRequest) Descriptor() ([]byte, []int) {
+	return file_service_registry_proto_rawDescGZIP(), []int{3}
+}
+
+// Change to the set of healthy services streamed by WatchServices
+type ServiceEvent struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Type          ServiceEvent_Type      `protobuf:"varint,1,opt,name=type,proto3,enum=serviceregistry.ServiceEvent_Type" json:"type,omitempty"`
+	Instance      *GrpcServiceInstance   `protobuf:"bytes,2,opt,name=instance,proto3" json:"instance,omitempty"` // unset for SYNCED
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ServiceEvent) Reset() {
+	*x = ServiceEvent{}
+	mi := &file_service_registry_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ServiceEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ServiceEvent) ProtoMessage() {}
+
+func (x *ServiceEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_service_registry_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ServiceEvent.ProtoReflect.Descriptor instead.
+func (*ServiceEvent) Descriptor() ([]byte, []int) {
+	return file_service_registry_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *ServiceEvent) GetType() ServiceEvent_Type {
+	if x != nil {
+		return x.Type
+	}
+	return ServiceEvent_UNSPECIFIED
+}
+
+func (x *ServiceEvent) GetInstance() *GrpcServiceInstance {
+	if x != nil {
+		return x.Instance
+	}
+	return nil
+}
+
 // Request message for RegisterService
 type RegisterServiceRequest struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
@@ -198,7 +359,7 @@ type RegisterServiceRequest struct {
 
 func (x *RegisterServiceRequest) Reset() {
 	*x = RegisterServiceRequest{}
-	mi := &file_service_registry_proto_msgTypes[3]
+	mi := &file_service_registry_proto_msgTypes[5]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -210,7 +371,7 @@ func (x *RegisterServiceRequest) String() string {
 func (*RegisterServiceRequest) ProtoMessage() {}
 
 func (x *RegisterServiceRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_service_registry_proto_msgTypes[3]
+	mi := &file_service_registry_proto_msgTypes[5]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -223,7 +384,7 @@ func (x *RegisterServiceRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use RegisterServiceRequest.ProtoReflect.Descriptor instead.
 func (*RegisterServiceRequest) Descriptor() ([]byte, []int) {
-	return file_service_registry_proto_rawDescGZIP(), []int{3}
+	return file_service_registry_proto_rawDescGZIP(), []int{5}
 }
 
 func (x *RegisterServiceRequest) GetInstance() *GrpcServiceInstance {
@@ -243,7 +404,7 @@ type DeregisterServiceRequest struct {
 
 func (x *DeregisterServiceRequest) Reset() {
 	*x = DeregisterServiceRequest{}
-	mi := &file_service_registry_proto_msgTypes[4]
+	mi := &file_service_registry_proto_msgTypes[6]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -255,7 +416,7 @@ func (x *DeregisterServiceRequest) String() string {
 func (*DeregisterServiceRequest) ProtoMessage() {}
 
 func (x *DeregisterServiceRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_service_registry_proto_msgTypes[4]
+	mi := &file_service_registry_proto_msgTypes[6]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -268,7 +429,7 @@ func (x *DeregisterServiceRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use DeregisterServiceRequest.ProtoReflect.Descriptor instead.
 func (*DeregisterServiceRequest) Descriptor() ([]byte, []int) {
-	return file_service_registry_proto_rawDescGZIP(), []int{4}
+	return file_service_registry_proto_rawDescGZIP(), []int{6}
 }
 
 func (x *DeregisterServiceRequest) GetInstanceId() string {
@@ -288,7 +449,7 @@ type SendHeartbeatRequest struct {
 
 func (x *SendHeartbeatRequest) Reset() {
 	*x = SendHeartbeatRequest{}
-	mi := &file_service_registry_proto_msgTypes[5]
+	mi := &file_service_registry_proto_msgTypes[7]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -300,7 +461,7 @@ func (x *SendHeartbeatRequest) String() string {
 func (*SendHeartbeatRequest) ProtoMessage() {}
 
 func (x *SendHeartbeatRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_service_registry_proto_msgTypes[5]
+	mi := &file_service_registry_proto_msgTypes[7]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -313,7 +474,7 @@ func (x *SendHeartbeatRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use SendHeartbeatRequest.ProtoReflect.Descriptor instead.
 func (*SendHeartbeatRequest) Descriptor() ([]byte, []int) {
-	return file_service_registry_proto_rawDescGZIP(), []int{5}
+	return file_service_registry_proto_rawDescGZIP(), []int{7}
 }
 
 func (x *SendHeartbeatRequest) GetInstanceId() string {
@@ -326,15 +487,15 @@ func (x *SendHeartbeatRequest) GetInstanceId() string {
 // Response message for registration, deregistration, heartbeat (empty)
 type ServiceRegistryResponse struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
-	Success       bool                   `protobuf:"varint,1,opt,name=success,proto3" json:"success,omitempty"` // Indicate success/failure
-	Message       string                 `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`  // Optional: provide more details
+	Success       bool                   `protobuf:"varint,1,opt,name=success,proto3" json:"success,omitempty"`
+	Message       string                 `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
 func (x *ServiceRegistryResponse) Reset() {
 	*x = ServiceRegistryResponse{}
-	mi := &file_service_registry_proto_msgTypes[6]
+	mi := &file_service_registry_proto_msgTypes[8]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -346,7 +507,7 @@ func (x *ServiceRegistryResponse) String() string {
 func (*ServiceRegistryResponse) ProtoMessage() {}
 
 func (x *ServiceRegistryResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_service_registry_proto_msgTypes[6]
+	mi := &file_service_registry_proto_msgTypes[8]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -359,7 +520,7 @@ func (x *ServiceRegistryResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use ServiceRegistryResponse.ProtoReflect.Descriptor instead.
 func (*ServiceRegistryResponse) Descriptor() ([]byte, []int) {
-	return file_service_registry_proto_rawDescGZIP(), []int{6}
+	return file_service_registry_proto_rawDescGZIP(), []int{8}
 }
 
 func (x *ServiceRegistryResponse) GetSuccess() bool {
@@ -380,7 +541,7 @@ var File_service_registry_proto protoreflect.FileDescriptor
 
 const file_service_registry_proto_rawDesc = "" +
 	"\n" +
-	"\x16service_registry.proto\x12\x0fserviceregistry\"\xa1\x01\n" +
+	"\x16service_registry.proto\x12\x0fserviceregistry\"\xc6\x02\n" +
 	"\x13GrpcServiceInstance\x12\x0e\n" +
 	"\x02id\x18\x01 \x01(\tR\x02id\x12 \n" +
 	"\vserviceName\x18\x02 \x01(\tR\vserviceName\x12\x12\n" +
@@ -389,10 +550,26 @@ const file_service_registry_proto_rawDesc = "" +
 	"\x03url\x18\x05 \x01(\tR\x03url\x12\x1e\n" +
 	"\n" +
 	"healthPath\x18\x06 \x01(\tR\n" +
-	"healthPath\"\x1b\n" +
+	"healthPath\x12\x16\n" +
+	"\x06weight\x18\a \x01(\x05R\x06weight\x12N\n" +
+	"\bmetadata\x18\b \x03(\v22.serviceregistry.GrpcServiceInstance.MetadataEntryR\bmetadata\x1a;\n" +
+	"\rMetadataEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\x1b\n" +
 	"\x19GetHealthyServicesRequest\"^\n" +
 	"\x1aGetHealthyServicesResponse\x12@\n" +
-	"\bservices\x18\x01 \x03(\v2$.serviceregistry.GrpcServiceInstanceR\bservices\"Z\n" +
+	"\bservices\x18\x01 \x03(\v2$.serviceregistry.GrpcServiceInstanceR\bservices\"\x16\n" +
+	"\x14WatchServicesRequest\"\xd2\x01\n" +
+	"\fServiceEvent\x126\n" +
+	"\x04type\x18\x01 \x01(\x0e2\".serviceregistry.ServiceEvent.TypeR\x04type\x12@\n" +
+	"\binstance\x18\x02 \x01(\v2$.serviceregistry.GrpcServiceInstanceR\binstance\"H\n" +
+	"\x04Type\x12\x0f\n" +
+	"\vUNSPECIFIED\x10\x00\x12\t\n" +
+	"\x05ADDED\x10\x01\x12\v\n" +
+	"\aUPDATED\x10\x02\x12\v\n" +
+	"\aREMOVED\x10\x03\x12\n" +
+	"\n" +
+	"\x06SYNCED\x10\x04\"Z\n" +
 	"\x16RegisterServiceRequest\x12@\n" +
 	"\binstance\x18\x01 \x01(\v2$.serviceregistry.GrpcServiceInstanceR\binstance\":\n" +
 	"\x18DeregisterServiceRequest\x12\x1e\n" +
@@ -405,9 +582,10 @@ const file_service_registry_proto_rawDesc = "" +
 	"instanceId\"M\n" +
 	"\x17ServiceRegistryResponse\x12\x18\n" +
 	"\asuccess\x18\x01 \x01(\bR\asuccess\x12\x18\n" +
-	"\amessage\x18\x02 \x01(\tR\amessage2\xb2\x03\n" +
+	"\amessage\x18\x02 \x01(\tR\amessage2\x8b\x04\n" +
 	"\x0fServiceRegistry\x12m\n" +
-	"\x12GetHealthyServices\x12*.serviceregistry.GetHealthyServicesRequest\x1a+.serviceregistry.GetHealthyServicesResponse\x12d\n" +
+	"\x12GetHealthyServices\x12*.serviceregistry.GetHealthyServicesRequest\x1a+.serviceregistry.GetHealthyServicesResponse\x12W\n" +
+	"\rWatchServices\x12%.serviceregistry.WatchServicesRequest\x1a\x1d.serviceregistry.ServiceEvent0\x01\x12d\n" +
 	"\x0fRegisterService\x12'.serviceregistry.RegisterServiceRequest\x1a(.serviceregistry.ServiceRegistryResponse\x12h\n" +
 	"\x11DeregisterService\x12).serviceregistry.DeregisterServiceRequest\x1a(.serviceregistry.ServiceRegistryResponse\x12`\n" +
 	"\rSendHeartbeat\x12%.serviceregistry.SendHeartbeatRequest\x1a(.serviceregistry.ServiceRegistryResponseBw\n" +
@@ -425,32 +603,42 @@ func file_service_registry_proto_rawDescGZIP() []byte {
 	return file_service_registry_proto_rawDescData
 }
 
-var file_service_registry_proto_msgTypes = make([]protoimpl.MessageInfo, 7)
+var file_service_registry_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_service_registry_proto_msgTypes = make([]protoimpl.MessageInfo, 10)
 var file_service_registry_proto_goTypes = []any{
-	(*GrpcServiceInstance)(nil),        // 0: serviceregistry.GrpcServiceInstance
-	(*GetHealthyServicesRequest)(nil),  // 1: serviceregistry.GetHealthyServicesRequest
-	(*GetHealthyServicesResponse)(nil), // 2: serviceregistry.GetHealthyServicesResponse
-	(*RegisterServiceRequest)(nil),     // 3: serviceregistry.RegisterServiceRequest
-	(*DeregisterServiceRequest)(nil),   // 4: serviceregistry.DeregisterServiceRequest
-	(*SendHeartbeatRequest)(nil),       // 5: serviceregistry.SendHeartbeatRequest
-	(*ServiceRegistryResponse)(nil),    // 6: serviceregistry.ServiceRegistryResponse
+	(ServiceEvent_Type)(0),             // 0: serviceregistry.ServiceEvent.Type
+	(*GrpcServiceInstance)(nil),        // 1: serviceregistry.GrpcServiceInstance
+	(*GetHealthyServicesRequest)(nil),  // 2: serviceregistry.GetHealthyServicesRequest
+	(*GetHealthyServicesResponse)(nil), // 3: serviceregistry.GetHealthyServicesResponse
+	(*WatchServicesRequest)(nil),       // 4: serviceregistry.WatchServicesRequest
+	(*ServiceEvent)(nil),               // 5: serviceregistry.ServiceEvent
+	(*RegisterServiceRequest)(nil),     // 6: serviceregistry.RegisterServiceRequest
+	(*DeregisterServiceRequest)(nil),   // 7: serviceregistry.DeregisterServiceRequest
+	(*SendHeartbeatRequest)(nil),       // 8: serviceregistry.SendHeartbeatRequest
+	(*ServiceRegistryResponse)(nil),    // 9: serviceregistry.ServiceRegistryResponse
+	nil,                                // 10: serviceregistry.GrpcServiceInstance.MetadataEntry
 }
 var file_service_registry_proto_depIdxs = []int32{
-	0, // 0: serviceregistry.GetHealthyServicesResponse.services:type_name -> serviceregistry.GrpcServiceInstance
-	0, // 1: serviceregistry.RegisterServiceRequest.instance:type_name -> serviceregistry.GrpcServiceInstance
-	1, // 2: serviceregistry.ServiceRegistry.GetHealthyServices:input_type -> serviceregistry.GetHealthyServicesRequest
-	3, // 3: serviceregistry.ServiceRegistry.RegisterService:input_type -> serviceregistry.RegisterServiceRequest
-	4, // 4: serviceregistry.ServiceRegistry.DeregisterService:input_type -> serviceregistry.DeregisterServiceRequest
-	5, // 5: serviceregistry.ServiceRegistry.SendHeartbeat:input_type -> serviceregistry.SendHeartbeatRequest
-	2, // 6: serviceregistry.ServiceRegistry.GetHealthyServices:output_type -> serviceregistry.GetHealthyServicesResponse
-	6, // 7: serviceregistry.ServiceRegistry.RegisterService:output_type -> serviceregistry.ServiceRegistryResponse
-	6, // 8: serviceregistry.ServiceRegistry.DeregisterService:output_type -> serviceregistry.ServiceRegistryResponse
-	6, // 9: serviceregistry.ServiceRegistry.SendHeartbeat:output_type -> serviceregistry.ServiceRegistryResponse
-	6, // [6:10] is the sub-list for method output_type
-	2, // [2:6] is the sub-list for method input_type
-	2, // [2:2] is the sub-list for extension type_name
-	2, // [2:2] is the sub-list for extension extendee
-	0, // [0:2] is the sub-list for field type_name
+	10, // 0: serviceregistry.GrpcServiceInstance.metadata:type_name -> serviceregistry.GrpcServiceInstance.MetadataEntry
+	1,  // 1: serviceregistry.GetHealthyServicesResponse.services:type_name -> serviceregistry.GrpcServiceInstance
+	0,  // 2: serviceregistry.ServiceEvent.type:type_name -> serviceregistry.ServiceEvent.Type
+	1,  // 3: serviceregistry.ServiceEvent.instance:type_name -> serviceregistry.GrpcServiceInstance
+	1,  // 4: serviceregistry.RegisterServiceRequest.instance:type_name -> serviceregistry.GrpcServiceInstance
+	2,  // 5: serviceregistry.ServiceRegistry.GetHealthyServices:input_type -> serviceregistry.GetHealthyServicesRequest
+	4,  // 6: serviceregistry.ServiceRegistry.WatchServices:input_type -> serviceregistry.WatchServicesRequest
+	6,  // 7: serviceregistry.ServiceRegistry.RegisterService:input_type -> serviceregistry.RegisterServiceRequest
+	7,  // 8: serviceregistry.ServiceRegistry.DeregisterService:input_type -> serviceregistry.DeregisterServiceRequest
+	8,  // 9: serviceregistry.ServiceRegistry.SendHeartbeat:input_type -> serviceregistry.SendHeartbeatRequest
+	3,  // 10: serviceregistry.ServiceRegistry.GetHealthyServices:output_type -> serviceregistry.GetHealthyServicesResponse
+	5,  // 11: serviceregistry.ServiceRegistry.WatchServices:output_type -> serviceregistry.ServiceEvent
+	9,  // 12: serviceregistry.ServiceRegistry.RegisterService:output_type -> serviceregistry.ServiceRegistryResponse
+	9,  // 13: serviceregistry.ServiceRegistry.DeregisterService:output_type -> serviceregistry.ServiceRegistryResponse
+	9,  // 14: serviceregistry.ServiceRegistry.SendHeartbeat:output_type -> serviceregistry.ServiceRegistryResponse
+	10, // [10:15] is the sub-list for method output_type
+	5,  // [5:10] is the sub-list for method input_type
+	5,  // [5:5] is the sub-list for extension type_name
+	5,  // [5:5] is the sub-list for extension extendee
+	0,  // [0:5] is the sub-list for field type_name
 }
 
 func init() { file_service_registry_proto_init() }
@@ -463,13 +651,14 @@ func file_service_registry_proto_init() {
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_service_registry_proto_rawDesc), len(file_service_registry_proto_rawDesc)),
-			NumEnums:      0,
-			NumMessages:   7,
+			NumEnums:      1,
+			NumMessages:   10,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
 		GoTypes:           file_service_registry_proto_goTypes,
 		DependencyIndexes: file_service_registry_proto_depIdxs,
+		EnumInfos:         file_service_registry_proto_enumTypes,
 		MessageInfos:      file_service_registry_proto_msgTypes,
 	}.Build()
 	File_service_registry_proto = out.File
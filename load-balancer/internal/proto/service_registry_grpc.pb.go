@@ -20,6 +20,7 @@ const _ = grpc.SupportPackageIsVersion9
 
 const (
 	ServiceRegistry_GetHealthyServices_FullMethodName = "/serviceregistry.ServiceRegistry/GetHealthyServices"
+	ServiceRegistry_WatchServices_FullMethodName      = "/serviceregistry.ServiceRegistry/WatchServices"
 	ServiceRegistry_RegisterService_FullMethodName    = "/serviceregistry.ServiceRegistry/RegisterService"
 	ServiceRegistry_DeregisterService_FullMethodName  = "/serviceregistry.ServiceRegistry/DeregisterService"
 	ServiceRegistry_SendHeartbeat_FullMethodName      = "/serviceregistry.ServiceRegistry/SendHeartbeat"
@@ -32,6 +33,7 @@ const (
 // ServiceRegistry service definition for gRPC
 type ServiceRegistryClient interface {
 	GetHealthyServices(ctx context.Context, in *GetHealthyServicesRequest, opts ...grpc.CallOption) (*GetHealthyServicesResponse, error)
+	WatchServices(ctx context.Context, in *WatchServicesRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ServiceEvent], error)
 	RegisterService(ctx context.Context, in *RegisterServiceRequest, opts ...grpc.CallOption) (*ServiceRegistryResponse, error)
 	DeregisterService(ctx context.Context, in *DeregisterServiceRequest, opts ...grpc.CallOption) (*ServiceRegistryResponse, error)
 	SendHeartbeat(ctx context.Context, in *SendHeartbeatRequest, opts ...grpc.CallOption) (*ServiceRegistryResponse, error)
@@ -55,6 +57,25 @@ func (c *serviceRegistryClient) GetHealthyServices(ctx context.Context, in *GetH
 	return out, nil
 }
 
+func (c *serviceRegistryClient) WatchServices(ctx context.Context, in *WatchServicesRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ServiceEvent], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &ServiceRegistry_ServiceDesc.Streams[0], ServiceRegistry_WatchServices_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchServicesRequest, ServiceEvent]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ServiceRegistry_WatchServicesClient = grpc.ServerStreamingClient[ServiceEvent]
+
 func (c *serviceRegistryClient) RegisterService(ctx context.Context, in *RegisterServiceRequest, opts ...grpc.CallOption) (*ServiceRegistryResponse, error) {
 	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
 	out := new(ServiceRegistryResponse)
@@ -92,6 +113,7 @@ func (c *serviceRegistryClient) SendHeartbeat(ctx context.Context, in *SendHeart
 // ServiceRegistry service definition for gRPC
 type ServiceRegistryServer interface {
 	GetHealthyServices(context.Context, *GetHealthyServicesRequest) (*GetHealthyServicesResponse, error)
+	WatchServices(*WatchServicesRequest, grpc.ServerStreamingServer[ServiceEvent]) error
 	RegisterService(context.Context, *RegisterServiceRequest) (*ServiceRegistryResponse, error)
 	DeregisterService(context.Context, *DeregisterServiceRequest) (*ServiceRegistryResponse, error)
 	SendHeartbeat(context.Context, *SendHeartbeatRequest) (*ServiceRegistryResponse, error)
@@ -108,6 +130,9 @@ type UnimplementedServiceRegistryServer struct{}
 func (UnimplementedServiceRegistryServer) GetHealthyServices(context.Context, *GetHealthyServicesRequest) (*GetHealthyServicesResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetHealthyServices not implemented")
 }
+func (UnimplementedServiceRegistryServer) WatchServices(*WatchServicesRequest, grpc.ServerStreamingServer[ServiceEvent]) error {
+	return status.Errorf(codes.Unimplemented, "method WatchServices not implemented")
+}
 func (UnimplementedServiceRegistryServer) RegisterService(context.Context, *RegisterServiceRequest) (*ServiceRegistryResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method RegisterService not implemented")
 }
@@ -156,6 +181,17 @@ func _ServiceRegistry_GetHealthyServices_Handler(srv interface{}, ctx context.Co
 	return interceptor(ctx, in, info, handler)
 }
 
+func _ServiceRegistry_WatchServices_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchServicesRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ServiceRegistryServer).WatchServices(m, &grpc.GenericServerStream[WatchServicesRequest, ServiceEvent]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ServiceRegistry_WatchServicesServer = grpc.ServerStreamingServer[ServiceEvent]
+
 func _ServiceRegistry_RegisterService_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(RegisterServiceRequest)
 	if err := dec(in); err != nil {
@@ -234,6 +270,12 @@ var ServiceRegistry_ServiceDesc = grpc.ServiceDesc{
 			Handler:    _ServiceRegistry_SendHeartbeat_Handler,
 		},
 	},
-	Streams:  []grpc.StreamDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchServices",
+			Handler:       _ServiceRegistry_WatchServices_Handler,
+			ServerStreams: true,
+		},
+	},
 	Metadata: "service_registry.proto",
 }
@@ -0,0 +1,138 @@
+package proxy
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMaxRetryBodyBytes   = 64 * 1024
+	defaultRetryBudgetPercent  = 20
+	defaultMinRetriesPerSecond = 10
+	// the budget looks at this much recent traffic, one bucket per second
+	retryBudgetWindowSeconds = 10
+)
+
+// returned for attempts the backend's circuit breaker rejected before anything was sent
+var errCircuitOpen = errors.New("circuit breaker is open")
+
+type RetryOptions struct {
+	MaxRetries   int   // additional attempts after the first one, 0 disables retries
+	MaxBodyBytes int64 // bodies larger than this are streamed and never retried
+}
+
+type budgetBucket struct {
+	second   int64
+	requests int
+	retries  int
+}
+
+// caps retries to a percentage of live traffic across every service, so a failing
+// pool cannot multiply its own load; a small floor keeps retries possible at low traffic
+type RetryBudget struct {
+	mu                  sync.Mutex
+	ratio               float64
+	minRetriesPerSecond int
+	buckets             [retryBudgetWindowSeconds]budgetBucket
+	now                 func() time.Time // replaced in tests
+}
+
+func NewRetryBudget(percent float64, minRetriesPerSecond int) *RetryBudget {
+	if percent <= 0 {
+		percent = defaultRetryBudgetPercent
+	}
+	if minRetriesPerSecond <= 0 {
+		minRetriesPerSecond = defaultMinRetriesPerSecond
+	}
+	return &RetryBudget{
+		ratio:               percent / 100,
+		minRetriesPerSecond: minRetriesPerSecond,
+		now:                 time.Now,
+	}
+}
+
+func (rb *RetryBudget) bucket(now time.Time) *budgetBucket {
+	second := now.Unix()
+	b := &rb.buckets[second%retryBudgetWindowSeconds]
+	if b.second != second {
+		*b = budgetBucket{second: second}
+	}
+	return b
+}
+
+func (rb *RetryBudget) RecordRequest() {
+	rb.mu.Lock()
+	rb.bucket(rb.now()).requests++
+	rb.mu.Unlock()
+}
+
+// withdraws a retry from the budget, if there is one left
+func (rb *RetryBudget) TryRetry() bool {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	now := rb.now()
+	requests, retries := 0, 0
+	for _, b := range rb.buckets {
+		if now.Unix()-b.second < retryBudgetWindowSeconds {
+			requests += b.requests
+			retries += b.retries
+		}
+	}
+
+	allowed := float64(rb.minRetriesPerSecond*retryBudgetWindowSeconds) + rb.ratio*float64(requests)
+	if float64(retries) >= allowed {
+		return false
+	}
+	rb.bucket(now).retries++
+	return true
+}
+
+// reads the body into memory so it can be sent again; bodies over the limit are left
+// streaming (with the already read prefix put back) and reported as not replayable
+func bufferBody(req *http.Request, limit int64) ([]byte, bool, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, true, nil
+	}
+	if req.ContentLength > limit {
+		return nil, false, nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(req.Body, limit+1))
+	if err != nil {
+		return nil, false, err
+	}
+	if int64(len(body)) > limit {
+		req.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), req.Body), req.Body}
+		return nil, false, nil
+	}
+
+	req.Body.Close()
+	return body, true, nil
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+// whether the request never reached the backend, which makes it safe to retry for any method
+func failedBeforeSending(err error) bool {
+	if errors.Is(err, errCircuitOpen) {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
@@ -0,0 +1,81 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time {
+	return c.t
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.t = c.t.Add(d)
+}
+
+func newTestBudget(percent float64, minRetriesPerSecond int) (*RetryBudget, *fakeClock) {
+	clock := &fakeClock{t: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}
+	rb := NewRetryBudget(percent, minRetriesPerSecond)
+	rb.now = clock.now
+	return rb, clock
+}
+
+// retries withdrawn until the budget says no
+func drain(rb *RetryBudget) int {
+	n := 0
+	for rb.TryRetry() {
+		n++
+	}
+	return n
+}
+
+func TestRetryBudget(t *testing.T) {
+	tests := []struct {
+		name                string
+		percent             float64
+		minRetriesPerSecond int
+		requests            int
+		want                int
+	}{
+		{"floor without traffic", 20, 1, 0, 10},
+		{"floor plus a share of requests", 20, 1, 100, 30},
+		{"defaults", 0, 0, 50, 110},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rb, _ := newTestBudget(tt.percent, tt.minRetriesPerSecond)
+			for i := 0; i < tt.requests; i++ {
+				rb.RecordRequest()
+			}
+			if got := drain(rb); got != tt.want {
+				t.Fatalf("retries allowed = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryBudgetWindowSlides(t *testing.T) {
+	rb, clock := newTestBudget(50, 1)
+	for i := 0; i < 20; i++ {
+		rb.RecordRequest()
+	}
+	if got := drain(rb); got != 20 {
+		t.Fatalf("retries allowed = %d, want 20", got)
+	}
+
+	// the requests and retries are still in the window
+	clock.advance(9 * time.Second)
+	if rb.TryRetry() {
+		t.Fatal("retry allowed while the spent budget is still in the window")
+	}
+
+	// everything from the first second has left the window, the whole floor is back
+	clock.advance(time.Second)
+	if got := drain(rb); got != 10 {
+		t.Fatalf("retries allowed after the window slid = %d, want 10", got)
+	}
+}
@@ -1,23 +1,147 @@
 package proxy
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
+	"io"
 	"log"
-	"net"
 	"net/http"
 	"net/http/httputil"
+	"time"
 
 	"github.com/lokeshllkumar/load-balancer/internal/balancer"
+	"github.com/lokeshllkumar/load-balancer/internal/forwarded"
+	"github.com/lokeshllkumar/load-balancer/internal/metrics"
 )
 
+type ProxyOptions struct {
+	Retry       RetryOptions
+	Streaming   StreamingOptions
+	RetryBudget *RetryBudget // shared by every handler, nil disables retries
+}
+
 type ReverseProxyHandler struct {
 	strategy balancer.LoadBalancingStrategy
+	options  ProxyOptions
+	proxy    *httputil.ReverseProxy // shared by every request, the target travels in the request context
+}
+
+// the state of a single proxied attempt, read and written by the shared reverse proxy's hooks
+type proxyAttempt struct {
+	backend   *balancer.Backend
+	failed    bool
+	status    int // of the backend's response, 0 when there was none
+	err       error
+	longLived bool // an upgraded connection or event stream
+	start     time.Time
+	recorded  bool         // the result has been reported to the backend
+	affinity  *http.Cookie // keeps the client on this backend, set on the response only if the backend answers
+}
+
+// reports the attempt's result to the backend once; long-lived responses report as their headers arrive,
+// an open stream is not slowness and must not hold a half-open circuit breaker's probe slot
+func (a *proxyAttempt) recordResult() {
+	if a.recorded {
+		return
+	}
+	a.recorded = true
+	latency := time.Since(a.start)
+	// only answers say how fast a backend is; one refusing connections would otherwise look like the fastest
+	if a.status != 0 {
+		a.backend.RecordLatency(latency)
+	}
+	a.backend.RecordResponse(a.status, latency)
+	if a.failed {
+		a.backend.RecordError()
+	} else {
+		a.backend.RecordSuccess()
+	}
+}
+
+// for attempts the client walked away from: the breaker slot is given back without blaming the backend,
+// and outlier detection never sees them, as it would count the missing response as a gateway failure
+func (a *proxyAttempt) recordCancelled() {
+	if a.recorded {
+		return
+	}
+	a.recorded = true
+	a.backend.ReleaseRequest()
+}
+
+// unexported, so no other package can collide with it
+type proxyAttemptKey struct{}
+
+func attemptFromContext(ctx context.Context) *proxyAttempt {
+	attempt, _ := ctx.Value(proxyAttemptKey{}).(*proxyAttempt)
+	return attempt
 }
 
-func NewReverseProxyHandler(strategy balancer.LoadBalancingStrategy) *ReverseProxyHandler {
-	return &ReverseProxyHandler{
+func NewReverseProxyHandler(strategy balancer.LoadBalancingStrategy, options ProxyOptions) *ReverseProxyHandler {
+	if options.Retry.MaxBodyBytes <= 0 {
+		options.Retry.MaxBodyBytes = defaultMaxRetryBodyBytes
+	}
+	h := &ReverseProxyHandler{
 		strategy: strategy,
+		options:  options,
+	}
+	h.proxy = &httputil.ReverseProxy{
+		Rewrite:        rewriteToBackend,
+		Transport:      backendTransport{},
+		ModifyResponse: h.modifyResponse,
+		ErrorHandler:   recordProxyError,
+		FlushInterval:  options.Streaming.FlushInterval,
+	}
+	return h
+}
+
+// points the request at the attempt's backend, keeping the client's Host header
+func rewriteToBackend(pr *httputil.ProxyRequest) {
+	attempt := attemptFromContext(pr.In.Context())
+	pr.SetURL(attempt.backend.URL)
+	pr.Out.Host = pr.In.Host
+	forwarded.SetHeaders(pr.Out.Header, pr.In)
+}
+
+// sends each request over the long-lived transport of the backend it was routed to
+type backendTransport struct{}
+
+func (backendTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return attemptFromContext(req.Context()).backend.Transport().RoundTrip(req)
+}
+
+// transport errors and 5xx responses both count as failures for the circuit breaker;
+// long-lived responses are moved out of the backend's request/response connection count and report their result right away
+func (h *ReverseProxyHandler) modifyResponse(resp *http.Response) error {
+	attempt := attemptFromContext(resp.Request.Context())
+	attempt.status = resp.StatusCode
+	if attempt.affinity != nil {
+		resp.Header.Add("Set-Cookie", attempt.affinity.String())
+	}
+	if resp.StatusCode >= http.StatusInternalServerError {
+		attempt.failed = true
+	}
+
+	if isLongLived(resp) {
+		attempt.longLived = true
+		attempt.backend.PromoteToLongLived()
+		attempt.recordResult()
+	}
+	if resp.StatusCode == http.StatusSwitchingProtocols && h.options.Streaming.IdleTimeout > 0 {
+		if conn, ok := resp.Body.(io.ReadWriteCloser); ok {
+			resp.Body = newIdleTimeoutConn(conn, h.options.Streaming.IdleTimeout, attempt.backend.InstanceID)
+		}
 	}
+	return nil
+}
+
+// the error is handed back to ServeHTTP, which either retries or writes the 502
+func recordProxyError(rw http.ResponseWriter, req *http.Request, err error) {
+	attempt := attemptFromContext(req.Context())
+	log.Printf("Proxy error for request %s to %s (ID: %s): %v", req.URL.Path, attempt.backend.URL.String(), attempt.backend.InstanceID, err)
+	attempt.failed = true
+	attempt.err = err
 }
 
 func (h *ReverseProxyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -25,49 +149,135 @@ func (h *ReverseProxyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 	switch h.strategy.(type) {
 	case *balancer.StrategyRoundRobin:
 		strategyName = "round_robin"
+	case *balancer.StrategyWeightedRoundRobin:
+		strategyName = "weighted_round_robin"
 	case *balancer.StrategyLeastConnections:
 		strategyName = "least_connections"
 	case *balancer.StrategyStickySessions:
 		strategyName = "sticky_sessions"
+	case *balancer.StrategyP2CPeakEWMA:
+		strategyName = "p2c_peak_ewma"
+	case *balancer.StrategyConsistentHash:
+		strategyName = "consistent_hash"
 	}
-	ctx := context.WithValue(r.Context(), "strategy_used", strategyName)
-	r = r.WithContext(ctx)
+	metrics.SetStrategy(r.Context(), strategyName)
 
+	retriesEnabled := h.options.Retry.MaxRetries > 0 && h.options.RetryBudget != nil
+	var body []byte
+	replayable := false
+	if retriesEnabled {
+		h.options.RetryBudget.RecordRequest()
 
-	backend := h.strategy.SelectBackend(r)
+		var err error
+		body, replayable, err = bufferBody(r, h.options.Retry.MaxBodyBytes)
+		if err != nil {
+			log.Printf("Failed to read request body for %s: %v", r.URL.Path, err)
+			http.Error(w, "Failed to read request body", http.StatusBadRequest)
+			return
+		}
+	}
 
-	if backend == nil {
-		log.Println("No healthy backend available")
-		http.Error(w, "No healthy backend available", http.StatusServiceUnavailable)
-		return
+	var lastErr error
+	for attempt := 0; ; attempt++ {
+		backend := h.strategy.SelectBackend(r)
+		if backend == nil {
+			if lastErr != nil {
+				writeProxyError(w, lastErr)
+				return
+			}
+			log.Println("No healthy backend available")
+			http.Error(w, "No healthy backend available", http.StatusServiceUnavailable)
+			return
+		}
+
+		if replayable && body != nil {
+			r.Body = io.NopCloser(bytes.NewReader(body))
+		}
+
+		err := h.forward(w, r, backend, strategyName)
+		if err == nil {
+			return
+		}
+		lastErr = err
+		if r.Context().Err() != nil {
+			log.Printf("Client gave up on request %s, not retrying", r.URL.Path)
+			return
+		}
+
+		// a half-open breaker out of probes; nothing was sent, so another backend is tried without using a retry
+		if errors.Is(err, errCircuitOpen) {
+			r = r.WithContext(balancer.WithExcludedBackend(r.Context(), backend))
+			attempt--
+			continue
+		}
+
+		if !retriesEnabled || !replayable || attempt >= h.options.Retry.MaxRetries || !(isIdempotent(r.Method) || failedBeforeSending(err)) {
+			writeProxyError(w, err)
+			return
+		}
+		if !h.options.RetryBudget.TryRetry() {
+			log.Printf("Retry budget exhausted, not retrying request %s", r.URL.Path)
+			metrics.RetriesTotal.WithLabelValues("budget_exhausted").Inc()
+			writeProxyError(w, err)
+			return
+		}
+
+		log.Printf("Retrying request %s on another backend (retry %d of %d)", r.URL.Path, attempt+1, h.options.Retry.MaxRetries)
+		metrics.RetriesTotal.WithLabelValues("retried").Inc()
+		r = r.WithContext(balancer.WithExcludedBackend(r.Context(), backend))
+	}
+}
+
+// proxies a single attempt; an error means nothing has been written to w yet
+func (h *ReverseProxyHandler) forward(w http.ResponseWriter, r *http.Request, backend *balancer.Backend, strategyName string) error {
+	// the breaker may have let its half-open probes go out since the backend was selected
+	if !backend.AllowRequest() {
+		log.Printf("Circuit breaker for backend %s (ID: %s) rejected the request", backend.URL.String(), backend.InstanceID)
+		return fmt.Errorf("backend %s: %w", backend.InstanceID, errCircuitOpen)
 	}
 
 	log.Printf("Routing request to backend: %s (ID: %s) using strategy: %s", backend.URL.String(), backend.InstanceID, strategyName)
 
+	attempt := &proxyAttempt{backend: backend, start: time.Now()}
 	backend.IncrementConnections()
+	completed := false
+	// deferred, as the reverse proxy aborts the handler with a panic when a response breaks off midway;
+	// the result has to reach the circuit breaker either way or a half-open probe slot is never given back
+	defer func() {
+		switch {
+		case r.Context().Err() != nil:
+			// the client hung up, which also aborts the response midway
+			attempt.recordCancelled()
+		case !completed:
+			attempt.failed = true
+			attempt.recordResult()
+		default:
+			attempt.recordResult()
+		}
 
-	proxy := httputil.NewSingleHostReverseProxy(backend.URL)
-
-	originalDirector := proxy.Director
-	proxy.Director = func(req *http.Request) {
-		originalDirector(req)
-		if clientIP, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
-			if req.Header.Get("X-Forwarded-For") == "" {
-				req.Header.Set("X-Forwarded-For", clientIP)
-			}
+		if attempt.longLived {
+			backend.DecrementLongLived()
+		} else {
+			backend.DecrementConnections()
 		}
-	}
+	}()
 
-	proxy.ErrorHandler = func(rw http.ResponseWriter, req *http.Request, err error) {
-		log.Printf("Proxy error for request %s to %s (ID: %s): %v", req.URL.Path, backend.URL.String(), backend.InstanceID, err)
-		backend.RecordError()
-		http.Error(rw, "Internal Server Error or Backend Unavailable", http.StatusBadGateway)
+	metrics.SetBackend(r.Context(), backend.InstanceID)
+	if affinity, ok := h.strategy.(balancer.AffinityStrategy); ok {
+		attempt.affinity = affinity.AffinityCookie(r, backend)
 	}
+	r = r.WithContext(context.WithValue(r.Context(), proxyAttemptKey{}, attempt))
 
-	ctxWithBackendID := context.WithValue(r.Context(), "backend_id", backend.InstanceID)
-	r = r.WithContext(ctxWithBackendID)
+	h.proxy.ServeHTTP(w, r)
+	completed = true
 
-	proxy.ServeHTTP(w, r)
+	return attempt.err
+}
 
-	backend.DecrementConnections()
-}
\ No newline at end of file
+func writeProxyError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errCircuitOpen) {
+		http.Error(w, "No healthy backend available", http.StatusServiceUnavailable)
+		return
+	}
+	http.Error(w, "Internal Server Error or Backend Unavailable", http.StatusBadGateway)
+}
@@ -0,0 +1,146 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"os"
+	"testing"
+
+	"github.com/lokeshllkumar/load-balancer/internal/balancer"
+	"github.com/lokeshllkumar/load-balancer/internal/registry"
+)
+
+// serves a fixed set of instances and no watch, so the manager falls back to polling
+type staticRegistry []registry.ServiceInstance
+
+func (r staticRegistry) GetServices() ([]registry.ServiceInstance, error) {
+	return r, nil
+}
+
+func (r staticRegistry) WatchServices(ctx context.Context) (<-chan registry.ServiceEvent, error) {
+	return nil, errors.New("watch not supported")
+}
+
+// a pool of backends answering with a small body, discovered and health checked once
+func newBenchmarkPool(b *testing.B, n int) *balancer.BackendManager {
+	instances := make(staticRegistry, n)
+	for i := range instances {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, "ok")
+		}))
+		b.Cleanup(server.Close)
+		instances[i] = registry.ServiceInstance{
+			ID:          "instance-" + string(rune('a'+i)),
+			ServiceName: "bench",
+			URL:         server.URL,
+			HealthPath:  "/health",
+		}
+	}
+
+	bm, err := balancer.NewBackendManager(instances, "bench", "10s", "1s", "/health")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(bm.Stop)
+	bm.Refresh()
+	if len(bm.GetHealthyBackends()) != n {
+		b.Fatalf("%d of %d backends healthy", len(bm.GetHealthyBackends()), n)
+	}
+	return bm
+}
+
+// the handler as it was before backends owned their transports: a new single host reverse proxy
+// for every request, sending through http.DefaultTransport, without retries or streaming support
+type perRequestProxyHandler struct {
+	strategy balancer.LoadBalancingStrategy
+}
+
+func (p perRequestProxyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := context.WithValue(r.Context(), "strategy_used", "round_robin")
+	r = r.WithContext(ctx)
+
+	backend := p.strategy.SelectBackend(r)
+	if backend == nil {
+		log.Println("No healthy backend available")
+		http.Error(w, "No healthy backend available", http.StatusServiceUnavailable)
+		return
+	}
+
+	log.Printf("Routing request to backend: %s (ID: %s) using strategy: %s", backend.URL.String(), backend.InstanceID, "round_robin")
+
+	backend.IncrementConnections()
+
+	proxy := httputil.NewSingleHostReverseProxy(backend.URL)
+
+	originalDirector := proxy.Director
+	proxy.Director = func(req *http.Request) {
+		originalDirector(req)
+		if clientIP, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+			if req.Header.Get("X-Forwarded-For") == "" {
+				req.Header.Set("X-Forwarded-For", clientIP)
+			}
+		}
+	}
+
+	proxy.ErrorHandler = func(rw http.ResponseWriter, req *http.Request, err error) {
+		log.Printf("Proxy error for request %s to %s (ID: %s): %v", req.URL.Path, backend.URL.String(), backend.InstanceID, err)
+		backend.RecordError()
+		http.Error(rw, "Internal Server Error or Backend Unavailable", http.StatusBadGateway)
+	}
+
+	ctxWithBackendID := context.WithValue(r.Context(), "backend_id", backend.InstanceID)
+	r = r.WithContext(ctxWithBackendID)
+
+	proxy.ServeHTTP(w, r)
+
+	backend.DecrementConnections()
+}
+
+func BenchmarkServeHTTP(b *testing.B) {
+	// every request is logged
+	log.SetOutput(io.Discard)
+	b.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	bm := newBenchmarkPool(b, 4)
+	handlers := []struct {
+		name    string
+		handler http.Handler
+	}{
+		{"shared_transport", NewReverseProxyHandler(balancer.NewRoundRobinStrategy(bm), ProxyOptions{})},
+		{"per_request_proxy", perRequestProxyHandler{strategy: balancer.NewRoundRobinStrategy(bm)}},
+	}
+
+	for _, h := range handlers {
+		b.Run(h.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				serveOnce(b, h.handler)
+			}
+		})
+		// concurrent requests to the same backends, beyond the default transport's two idle connections per host
+		b.Run(h.name+"/parallel", func(b *testing.B) {
+			b.SetParallelism(8)
+			b.ReportAllocs()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					serveOnce(b, h.handler)
+				}
+			})
+		})
+	}
+}
+
+func serveOnce(b *testing.B, handler http.Handler) {
+	req := httptest.NewRequest(http.MethodGet, "http://lb.example.com/orders", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		b.Errorf("unexpected status %d", w.Code)
+	}
+}
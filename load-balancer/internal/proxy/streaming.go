@@ -0,0 +1,70 @@
+package proxy
+
+import (
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type StreamingOptions struct {
+	FlushInterval time.Duration // periodic flushing of buffered responses, negative flushes after every write
+	IdleTimeout   time.Duration // closes upgraded connections without traffic in either direction, 0 disables
+}
+
+// upgraded connections and event streams can stay open for hours
+func isLongLived(resp *http.Response) bool {
+	if resp.StatusCode == http.StatusSwitchingProtocols {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	return err == nil && mediaType == "text/event-stream"
+}
+
+// the backend side of an upgraded connection, closed once nothing has been read or written for the timeout;
+// closing it ends the copy in both directions, which makes the proxy close the client side too
+type idleTimeoutConn struct {
+	io.ReadWriteCloser
+	timeout time.Duration
+	timer   *time.Timer
+	once    sync.Once
+}
+
+func newIdleTimeoutConn(conn io.ReadWriteCloser, timeout time.Duration, backendID string) *idleTimeoutConn {
+	c := &idleTimeoutConn{
+		ReadWriteCloser: conn,
+		timeout:         timeout,
+	}
+	c.timer = time.AfterFunc(timeout, func() {
+		log.Printf("Closing upgraded connection to backend %s after %v without traffic", backendID, timeout)
+		c.Close()
+	})
+	return c
+}
+
+func (c *idleTimeoutConn) Read(p []byte) (int, error) {
+	n, err := c.ReadWriteCloser.Read(p)
+	if n > 0 {
+		c.timer.Reset(c.timeout)
+	}
+	return n, err
+}
+
+func (c *idleTimeoutConn) Write(p []byte) (int, error) {
+	n, err := c.ReadWriteCloser.Write(p)
+	if n > 0 {
+		c.timer.Reset(c.timeout)
+	}
+	return n, err
+}
+
+func (c *idleTimeoutConn) Close() error {
+	var err error
+	c.once.Do(func() {
+		c.timer.Stop()
+		err = c.ReadWriteCloser.Close()
+	})
+	return err
+}
@@ -0,0 +1,195 @@
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+const (
+	v1Prefix = "PROXY "
+	// the longest v1 line the spec allows, including the CRLF
+	v1MaxLength = 107
+)
+
+var v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// the connection endpoints a PROXY protocol header reports; nil addresses mean the sender gave none
+// (v1 UNKNOWN, v2 LOCAL such as health checks, or a family other than TCP over IPv4/IPv6)
+type Header struct {
+	Version     int
+	Source      *net.TCPAddr
+	Destination *net.TCPAddr
+}
+
+// reads a v1 or v2 header, which must be the first bytes on the connection
+func ReadHeader(r *bufio.Reader) (*Header, error) {
+	first, err := r.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+	switch first[0] {
+	case v1Prefix[0]:
+		return readV1(r)
+	case v2Signature[0]:
+		return readV2(r)
+	default:
+		return nil, fmt.Errorf("missing PROXY protocol header")
+	}
+}
+
+func readV1(r *bufio.Reader) (*Header, error) {
+	var line []byte
+	for len(line) < v1MaxLength {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+	if !bytes.HasPrefix(line, []byte(v1Prefix)) || !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, fmt.Errorf("malformed PROXY protocol v1 header")
+	}
+
+	fields := strings.Fields(string(line[len(v1Prefix) : len(line)-2]))
+	header := &Header{Version: 1}
+	if len(fields) > 0 && fields[0] == "UNKNOWN" {
+		return header, nil
+	}
+	if len(fields) != 5 || (fields[0] != "TCP4" && fields[0] != "TCP6") {
+		return nil, fmt.Errorf("malformed PROXY protocol v1 header")
+	}
+	source, err := parseV1Addr(fields[1], fields[3])
+	if err != nil {
+		return nil, err
+	}
+	destination, err := parseV1Addr(fields[2], fields[4])
+	if err != nil {
+		return nil, err
+	}
+	if (source.IP.To4() != nil) != (fields[0] == "TCP4") || (destination.IP.To4() != nil) != (fields[0] == "TCP4") {
+		return nil, fmt.Errorf("PROXY protocol v1 addresses do not match %s", fields[0])
+	}
+	header.Source, header.Destination = source, destination
+	return header, nil
+}
+
+func parseV1Addr(ip string, port string) (*net.TCPAddr, error) {
+	parsedIP := net.ParseIP(ip)
+	if parsedIP == nil {
+		return nil, fmt.Errorf("invalid address %q in PROXY protocol v1 header", ip)
+	}
+	parsedPort, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port %q in PROXY protocol v1 header", port)
+	}
+	return &net.TCPAddr{IP: parsedIP, Port: int(parsedPort)}, nil
+}
+
+func readV2(r *bufio.Reader) (*Header, error) {
+	var fixed [16]byte
+	if _, err := io.ReadFull(r, fixed[:]); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(fixed[:12], v2Signature) {
+		return nil, fmt.Errorf("malformed PROXY protocol v2 signature")
+	}
+	if fixed[12]>>4 != 2 {
+		return nil, fmt.Errorf("unsupported PROXY protocol version %d", fixed[12]>>4)
+	}
+	command := fixed[12] & 0x0f
+	if command > 1 {
+		return nil, fmt.Errorf("unsupported PROXY protocol v2 command %d", command)
+	}
+
+	payload := make([]byte, binary.BigEndian.Uint16(fixed[14:16]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+
+	header := &Header{Version: 2}
+	// LOCAL connections come from the sender itself, their addresses are ignored
+	if command == 0 {
+		return header, nil
+	}
+
+	// anything past the addresses is TLVs, which are not used
+	switch fixed[13] {
+	case 0x11: // TCP over IPv4
+		if len(payload) < 12 {
+			return nil, fmt.Errorf("truncated PROXY protocol v2 IPv4 addresses")
+		}
+		header.Source = &net.TCPAddr{IP: net.IP(payload[0:4]), Port: int(binary.BigEndian.Uint16(payload[8:10]))}
+		header.Destination = &net.TCPAddr{IP: net.IP(payload[4:8]), Port: int(binary.BigEndian.Uint16(payload[10:12]))}
+	case 0x21: // TCP over IPv6
+		if len(payload) < 36 {
+			return nil, fmt.Errorf("truncated PROXY protocol v2 IPv6 addresses")
+		}
+		header.Source = &net.TCPAddr{IP: net.IP(payload[0:16]), Port: int(binary.BigEndian.Uint16(payload[32:34]))}
+		header.Destination = &net.TCPAddr{IP: net.IP(payload[16:32]), Port: int(binary.BigEndian.Uint16(payload[34:36]))}
+	}
+	return header, nil
+}
+
+// encodes a header reporting source and destination; addresses that are not TCP over IPv4 or IPv6
+// of the same family are sent as v1 UNKNOWN or v2 LOCAL
+func FormatHeader(version int, source net.Addr, destination net.Addr) ([]byte, error) {
+	src, srcOK := source.(*net.TCPAddr)
+	dst, dstOK := destination.(*net.TCPAddr)
+	known := srcOK && dstOK && (src.IP.To4() != nil) == (dst.IP.To4() != nil)
+	ipv4 := known && src.IP.To4() != nil
+
+	switch version {
+	case 1:
+		if !known {
+			return []byte("PROXY UNKNOWN\r\n"), nil
+		}
+		family := "TCP6"
+		if ipv4 {
+			family = "TCP4"
+		}
+		return []byte(fmt.Sprintf("PROXY %s %s %s %d %d\r\n", family, src.IP, dst.IP, src.Port, dst.Port)), nil
+	case 2:
+		buf := bytes.NewBuffer(append([]byte(nil), v2Signature...))
+		if !known {
+			buf.Write([]byte{0x20, 0x00, 0x00, 0x00})
+			return buf.Bytes(), nil
+		}
+		if ipv4 {
+			buf.Write([]byte{0x21, 0x11, 0x00, 12})
+			buf.Write(src.IP.To4())
+			buf.Write(dst.IP.To4())
+		} else {
+			buf.Write([]byte{0x21, 0x21, 0x00, 36})
+			buf.Write(src.IP.To16())
+			buf.Write(dst.IP.To16())
+		}
+		binary.Write(buf, binary.BigEndian, uint16(src.Port))
+		binary.Write(buf, binary.BigEndian, uint16(dst.Port))
+		return buf.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("unsupported PROXY protocol version %d", version)
+	}
+}
+
+// accepts "v1" or "v2"; empty means headers are not sent and parses to 0
+func ParseVersion(version string) (int, error) {
+	switch version {
+	case "":
+		return 0, nil
+	case "v1":
+		return 1, nil
+	case "v2":
+		return 2, nil
+	default:
+		return 0, fmt.Errorf("unsupported PROXY protocol version %q", version)
+	}
+}
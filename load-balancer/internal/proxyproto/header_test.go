@@ -0,0 +1,193 @@
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+// a v2 header with the given version and command byte, family byte and payload
+func v2Header(versionCommand byte, family byte, payload []byte) []byte {
+	header := append([]byte(nil), v2Signature...)
+	header = append(header, versionCommand, family)
+	header = binary.BigEndian.AppendUint16(header, uint16(len(payload)))
+	return append(header, payload...)
+}
+
+func v2IPv4Payload() []byte {
+	payload := []byte{192, 0, 2, 10, 198, 51, 100, 1}
+	payload = binary.BigEndian.AppendUint16(payload, 51234)
+	return binary.BigEndian.AppendUint16(payload, 443)
+}
+
+func v2IPv6Payload() []byte {
+	payload := append(net.ParseIP("2001:db8::1").To16(), net.ParseIP("2001:db8::2").To16()...)
+	payload = binary.BigEndian.AppendUint16(payload, 51234)
+	return binary.BigEndian.AppendUint16(payload, 443)
+}
+
+func TestReadHeader(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       []byte
+		wantVersion int
+		wantSource  string // empty when the header carries no addresses
+		wantDest    string
+		wantErr     bool
+	}{
+		{
+			name:        "v1 TCP4",
+			input:       []byte("PROXY TCP4 192.0.2.10 198.51.100.1 51234 443\r\n"),
+			wantVersion: 1,
+			wantSource:  "192.0.2.10:51234",
+			wantDest:    "198.51.100.1:443",
+		},
+		{
+			name:        "v1 TCP6",
+			input:       []byte("PROXY TCP6 2001:db8::1 2001:db8::2 51234 443\r\n"),
+			wantVersion: 1,
+			wantSource:  "[2001:db8::1]:51234",
+			wantDest:    "[2001:db8::2]:443",
+		},
+		{
+			name:        "v1 UNKNOWN",
+			input:       []byte("PROXY UNKNOWN ffff::1 ffff::2 1 2\r\n"),
+			wantVersion: 1,
+		},
+		{name: "v1 without CRLF", input: []byte("PROXY TCP4 192.0.2.10 198.51.100.1 51234 443\n"), wantErr: true},
+		{name: "v1 truncated", input: []byte("PROXY TCP4 192.0.2.10 198.51"), wantErr: true},
+		{name: "v1 oversized", input: []byte("PROXY TCP4 " + strings.Repeat("1", v1MaxLength) + "\r\n"), wantErr: true},
+		{name: "v1 unknown family", input: []byte("PROXY UDP4 192.0.2.10 198.51.100.1 51234 443\r\n"), wantErr: true},
+		{name: "v1 family mismatch", input: []byte("PROXY TCP4 2001:db8::1 198.51.100.1 51234 443\r\n"), wantErr: true},
+		{name: "v1 invalid port", input: []byte("PROXY TCP4 192.0.2.10 198.51.100.1 65536 443\r\n"), wantErr: true},
+		{name: "v1 missing fields", input: []byte("PROXY TCP4 192.0.2.10 198.51.100.1 51234\r\n"), wantErr: true},
+		{
+			name:        "v2 TCP over IPv4",
+			input:       v2Header(0x21, 0x11, v2IPv4Payload()),
+			wantVersion: 2,
+			wantSource:  "192.0.2.10:51234",
+			wantDest:    "198.51.100.1:443",
+		},
+		{
+			name:        "v2 TCP over IPv6",
+			input:       v2Header(0x21, 0x21, v2IPv6Payload()),
+			wantVersion: 2,
+			wantSource:  "[2001:db8::1]:51234",
+			wantDest:    "[2001:db8::2]:443",
+		},
+		{
+			name:        "v2 with TLVs after the addresses",
+			input:       v2Header(0x21, 0x11, append(v2IPv4Payload(), 0x04, 0x00, 0x01, 0xff)),
+			wantVersion: 2,
+			wantSource:  "192.0.2.10:51234",
+			wantDest:    "198.51.100.1:443",
+		},
+		{
+			name:        "v2 LOCAL ignores addresses",
+			input:       v2Header(0x20, 0x11, v2IPv4Payload()),
+			wantVersion: 2,
+		},
+		{
+			name:        "v2 unix socket family",
+			input:       v2Header(0x21, 0x31, make([]byte, 216)),
+			wantVersion: 2,
+		},
+		{name: "v2 truncated signature", input: v2Signature[:8], wantErr: true},
+		{name: "v2 bad signature", input: append([]byte("\r\n\r\n\x00\r\nQUIX\n"), 0x21, 0x11, 0x00, 0x00), wantErr: true},
+		{name: "v2 unsupported version", input: v2Header(0x11, 0x11, v2IPv4Payload()), wantErr: true},
+		{name: "v2 unsupported command", input: v2Header(0x22, 0x11, v2IPv4Payload()), wantErr: true},
+		{name: "v2 truncated payload", input: v2Header(0x21, 0x11, v2IPv4Payload())[:20], wantErr: true},
+		{name: "v2 IPv4 addresses too short", input: v2Header(0x21, 0x11, make([]byte, 8)), wantErr: true},
+		{name: "v2 IPv6 addresses too short", input: v2Header(0x21, 0x21, make([]byte, 12)), wantErr: true},
+		{name: "no header", input: []byte("GET / HTTP/1.1\r\n"), wantErr: true},
+		{name: "empty", input: nil, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := bufio.NewReader(io.MultiReader(bytes.NewReader(tt.input), strings.NewReader("payload")))
+			header, err := ReadHeader(r)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ReadHeader() = %+v, want an error", header)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ReadHeader() error = %v", err)
+			}
+			if header.Version != tt.wantVersion {
+				t.Errorf("version = %d, want %d", header.Version, tt.wantVersion)
+			}
+			if got := addrString(header.Source); got != tt.wantSource {
+				t.Errorf("source = %q, want %q", got, tt.wantSource)
+			}
+			if got := addrString(header.Destination); got != tt.wantDest {
+				t.Errorf("destination = %q, want %q", got, tt.wantDest)
+			}
+			// the header is consumed exactly, whatever follows belongs to the application
+			if rest, _ := io.ReadAll(r); string(rest) != "payload" {
+				t.Errorf("bytes after the header = %q, want %q", rest, "payload")
+			}
+		})
+	}
+}
+
+func addrString(addr *net.TCPAddr) string {
+	if addr == nil {
+		return ""
+	}
+	return addr.String()
+}
+
+func TestFormatHeader(t *testing.T) {
+	ipv4Source := &net.TCPAddr{IP: net.ParseIP("192.0.2.10"), Port: 51234}
+	ipv4Dest := &net.TCPAddr{IP: net.ParseIP("198.51.100.1"), Port: 443}
+	ipv6Source := &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 51234}
+	ipv6Dest := &net.TCPAddr{IP: net.ParseIP("2001:db8::2"), Port: 443}
+	unixAddr := &net.UnixAddr{Name: "/run/lb.sock", Net: "unix"}
+
+	tests := []struct {
+		name        string
+		source      net.Addr
+		destination net.Addr
+		wantSource  string // empty when the header is sent without addresses
+		wantDest    string
+	}{
+		{"IPv4", ipv4Source, ipv4Dest, "192.0.2.10:51234", "198.51.100.1:443"},
+		{"IPv6", ipv6Source, ipv6Dest, "[2001:db8::1]:51234", "[2001:db8::2]:443"},
+		{"mixed families", ipv4Source, ipv6Dest, "", ""},
+		{"not TCP", unixAddr, ipv4Dest, "", ""},
+	}
+	for _, version := range []int{1, 2} {
+		for _, tt := range tests {
+			t.Run(fmt.Sprintf("%s/v%d", tt.name, version), func(t *testing.T) {
+				encoded, err := FormatHeader(version, tt.source, tt.destination)
+				if err != nil {
+					t.Fatalf("FormatHeader() error = %v", err)
+				}
+				header, err := ReadHeader(bufio.NewReader(bytes.NewReader(encoded)))
+				if err != nil {
+					t.Fatalf("ReadHeader() of %q error = %v", encoded, err)
+				}
+				if header.Version != version {
+					t.Errorf("version = %d, want %d", header.Version, version)
+				}
+				if got := addrString(header.Source); got != tt.wantSource {
+					t.Errorf("source = %q, want %q", got, tt.wantSource)
+				}
+				if got := addrString(header.Destination); got != tt.wantDest {
+					t.Errorf("destination = %q, want %q", got, tt.wantDest)
+				}
+			})
+		}
+	}
+
+	if _, err := FormatHeader(3, ipv4Source, ipv4Dest); err == nil {
+		t.Error("FormatHeader() accepted version 3")
+	}
+}
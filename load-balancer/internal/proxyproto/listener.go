@@ -0,0 +1,97 @@
+package proxyproto
+
+import (
+	"bufio"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/lokeshllkumar/load-balancer/internal/netutil"
+)
+
+// how long a trusted peer has to send its header before the connection is dropped
+const headerTimeout = 5 * time.Second
+
+// wraps a listener so connections from trusted peers report the client and destination addresses
+// from the PROXY protocol header they must start with; other peers are passed through untouched,
+// so they cannot spoof their address
+type Listener struct {
+	net.Listener
+	trusted []*net.IPNet
+}
+
+func NewListener(inner net.Listener, trusted []*net.IPNet) *Listener {
+	return &Listener{Listener: inner, trusted: trusted}
+}
+
+// the header is read on first use rather than here, so a slow peer does not hold up the accept loop
+func (l *Listener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if !l.isTrusted(conn.RemoteAddr()) {
+		return conn, nil
+	}
+	return &Conn{Conn: conn, reader: bufio.NewReader(conn)}, nil
+}
+
+func (l *Listener) isTrusted(addr net.Addr) bool {
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	return ok && netutil.ContainsIP(l.trusted, tcpAddr.IP)
+}
+
+// a connection from a trusted peer; reads, RemoteAddr and LocalAddr all wait for the header
+type Conn struct {
+	net.Conn
+	reader    *bufio.Reader
+	once      sync.Once
+	header    *Header
+	headerErr error
+}
+
+func (c *Conn) readHeader() {
+	c.once.Do(func() {
+		// servers ask for RemoteAddr before setting deadlines of their own, so clearing this one afterwards is safe
+		c.Conn.SetReadDeadline(time.Now().Add(headerTimeout))
+		c.header, c.headerErr = ReadHeader(c.reader)
+		c.Conn.SetReadDeadline(time.Time{})
+		if c.headerErr != nil {
+			log.Printf("Rejecting connection from %s: invalid PROXY protocol header: %v", c.Conn.RemoteAddr(), c.headerErr)
+			c.Conn.Close()
+		}
+	})
+}
+
+func (c *Conn) Read(b []byte) (int, error) {
+	c.readHeader()
+	if c.headerErr != nil {
+		return 0, c.headerErr
+	}
+	return c.reader.Read(b)
+}
+
+func (c *Conn) RemoteAddr() net.Addr {
+	c.readHeader()
+	if c.header != nil && c.header.Source != nil {
+		return c.header.Source
+	}
+	return c.Conn.RemoteAddr()
+}
+
+func (c *Conn) LocalAddr() net.Addr {
+	c.readHeader()
+	if c.header != nil && c.header.Destination != nil {
+		return c.header.Destination
+	}
+	return c.Conn.LocalAddr()
+}
+
+// keeps half-closes working for the TCP listeners
+func (c *Conn) CloseWrite() error {
+	if closer, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return closer.CloseWrite()
+	}
+	return c.Conn.Close()
+}
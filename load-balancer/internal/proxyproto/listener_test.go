@@ -0,0 +1,104 @@
+package proxyproto
+
+import (
+	"io"
+	"log"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/lokeshllkumar/load-balancer/internal/netutil"
+)
+
+func TestListener(t *testing.T) {
+	// rejected headers are logged
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	tests := []struct {
+		name       string
+		trusted    string
+		sent       string
+		wantRemote string // empty expects the peer's own address
+		wantData   string
+		wantErr    bool
+	}{
+		{
+			name:       "trusted peer reports the client",
+			trusted:    "127.0.0.0/8",
+			sent:       "PROXY TCP4 192.0.2.10 127.0.0.1 51234 443\r\nhello",
+			wantRemote: "192.0.2.10:51234",
+			wantData:   "hello",
+		},
+		{
+			name:     "trusted peer sending LOCAL keeps its own address",
+			trusted:  "127.0.0.0/8",
+			sent:     string(v2Header(0x20, 0x00, nil)) + "hello",
+			wantData: "hello",
+		},
+		{
+			name:    "trusted peer without a header is rejected",
+			trusted: "127.0.0.0/8",
+			sent:    "hello",
+			wantErr: true,
+		},
+		{
+			name:     "untrusted peer cannot spoof its address",
+			trusted:  "10.0.0.0/8",
+			sent:     "PROXY TCP4 192.0.2.10 127.0.0.1 51234 443\r\nhello",
+			wantData: "PROXY TCP4 192.0.2.10 127.0.0.1 51234 443\r\nhello",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trusted, err := netutil.ParseCIDRs([]string{tt.trusted})
+			if err != nil {
+				t.Fatal(err)
+			}
+			inner, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			l := NewListener(inner, trusted)
+			defer l.Close()
+
+			client, err := net.Dial("tcp", inner.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer client.Close()
+			if _, err := io.WriteString(client, tt.sent); err != nil {
+				t.Fatal(err)
+			}
+			client.(*net.TCPConn).CloseWrite()
+
+			conn, err := l.Accept()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+
+			wantRemote := tt.wantRemote
+			if wantRemote == "" {
+				wantRemote = client.LocalAddr().String()
+			}
+			if got := conn.RemoteAddr().String(); got != wantRemote {
+				t.Errorf("RemoteAddr() = %q, want %q", got, wantRemote)
+			}
+
+			data, err := io.ReadAll(conn)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("read %q, want an error", data)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("read error = %v", err)
+			}
+			if string(data) != tt.wantData {
+				t.Errorf("read %q, want %q", data, tt.wantData)
+			}
+		})
+	}
+}
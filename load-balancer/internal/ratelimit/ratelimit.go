@@ -0,0 +1,159 @@
+package ratelimit
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lokeshllkumar/load-balancer/internal/forwarded"
+	"github.com/lokeshllkumar/load-balancer/internal/metrics"
+)
+
+const (
+	defaultMaxKeys      = 10000
+	defaultAPIKeyHeader = "X-API-Key"
+)
+
+type Options struct {
+	Route             string // metrics label
+	RequestsPerSecond float64
+	Burst             int    // bucket size, at least 1
+	Key               string // ip (default), header, apiKey or route
+	KeyName           string // header name for header and apiKey
+	MaxKeys           int    // buckets kept before the least recently used one is evicted
+}
+
+// a token bucket per key, the least recently used ones evicted once MaxKeys is reached;
+// an evicted key starts over with a full bucket
+type Limiter struct {
+	options Options
+	mu      sync.Mutex
+	buckets map[string]*list.Element
+	lru     *list.List // front is the most recently used
+}
+
+type bucket struct {
+	key     string
+	tokens  float64
+	last    time.Time
+	limited bool // rejected since it last had a token, so the rejection is logged once
+}
+
+func NewLimiter(options Options) *Limiter {
+	if options.Burst < 1 {
+		options.Burst = int(math.Max(1, math.Ceil(options.RequestsPerSecond)))
+	}
+	if options.MaxKeys <= 0 {
+		options.MaxKeys = defaultMaxKeys
+	}
+	if options.Key == "apiKey" && options.KeyName == "" {
+		options.KeyName = defaultAPIKeyHeader
+	}
+	return &Limiter{
+		options: options,
+		buckets: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// takes a token for key; when none is left, reports how long until the next one
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	allowed, wait, _ := l.take(key)
+	return allowed, wait
+}
+
+// Allow, also reporting whether this is the first rejection since the key last had a token
+func (l *Limiter) take(key string) (bool, time.Duration, bool) {
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var b *bucket
+	if element, found := l.buckets[key]; found {
+		l.lru.MoveToFront(element)
+		b = element.Value.(*bucket)
+		refill := now.Sub(b.last).Seconds() * l.options.RequestsPerSecond
+		b.tokens = math.Min(float64(l.options.Burst), b.tokens+refill)
+		b.last = now
+	} else {
+		if l.lru.Len() >= l.options.MaxKeys {
+			oldest := l.lru.Back()
+			l.lru.Remove(oldest)
+			delete(l.buckets, oldest.Value.(*bucket).key)
+		}
+		b = &bucket{key: key, tokens: float64(l.options.Burst), last: now}
+		l.buckets[key] = l.lru.PushFront(b)
+		metrics.RateLimitKeysGauge.WithLabelValues(l.options.Route).Set(float64(l.lru.Len()))
+	}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		b.limited = false
+		return true, 0, false
+	}
+	wait := time.Duration((1 - b.tokens) / l.options.RequestsPerSecond * float64(time.Second))
+	newlyLimited := !b.limited
+	b.limited = true
+	return false, wait, newlyLimited
+}
+
+// the bucket a request draws from; requests missing the configured header are limited by client IP instead
+func (l *Limiter) keyFor(r *http.Request) string {
+	switch l.options.Key {
+	case "route":
+		return "route"
+	case "header":
+		if value := r.Header.Get(l.options.KeyName); value != "" {
+			return "header:" + value
+		}
+	case "apiKey":
+		if value := r.Header.Get(l.options.KeyName); value != "" {
+			return "key:" + value
+		}
+		if token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); found && token != "" {
+			return "key:" + token
+		}
+	}
+	return "ip:" + forwarded.ClientIP(r)
+}
+
+// rejects requests over the limit with 429 and a Retry-After in whole seconds
+func (l *Limiter) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := l.keyFor(r)
+		allowed, wait, newlyLimited := l.take(key)
+		if !allowed {
+			metrics.RateLimitRequestsTotal.WithLabelValues(l.options.Route, "rejected").Inc()
+			// further rejections only show in the metric, a client hammering away would flood the log
+			if newlyLimited {
+				log.Printf("Rate limit exceeded on route %q for %s", l.options.Route, redactKey(key))
+			}
+			retryAfter := int(math.Ceil(wait.Seconds()))
+			if retryAfter < 1 {
+				retryAfter = 1
+			}
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+			return
+		}
+		metrics.RateLimitRequestsTotal.WithLabelValues(l.options.Route, "allowed").Inc()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// header values and API keys are credentials as often as not, so only a hash prefix of them is logged
+func redactKey(key string) string {
+	kind, value, found := strings.Cut(key, ":")
+	if !found || kind == "ip" {
+		return key
+	}
+	sum := sha256.Sum256([]byte(value))
+	return kind + ":sha256:" + hex.EncodeToString(sum[:4])
+}
@@ -2,6 +2,7 @@ package registry
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -12,26 +13,33 @@ import (
 
 	pb "github.com/lokeshllkumar/load-balancer/internal/proto"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
 )
 
 type ServiceInstance struct {
-	ID         string `json:"id"`
-	URL        string `json:"url"`
-	HealthPath string `json:"healthPath"`
+	ID          string `json:"id"`
+	ServiceName string `json:"serviceName"`
+	URL         string `json:"url"`
+	HealthPath  string `json:"healthPath"`
+	Weight      int    `json:"weight"` // 0 when the instance does not report one
+	Metadata    map[string]string `json:"metadata"` // free-form, e.g. healthCheckType
 }
 
 type ServiceRegistryClient interface {
 	GetServices() ([]ServiceInstance, error)
+	// streams changes to the healthy services, starting with every currently healthy instance
+	// as ServiceAdded followed by ServicesSynced; the channel is closed when the stream breaks or ctx is done
+	WatchServices(ctx context.Context) (<-chan ServiceEvent, error)
 }
 
-// creates HTTP or gRPC registry client
-func NewServiceRegistryClient(clientType string, address string) (ServiceRegistryClient, error) {
+// creates HTTP or gRPC registry client; a nil tlsConfig means plaintext gRPC and default HTTPS settings
+func NewServiceRegistryClient(clientType string, address string, tlsConfig *tls.Config) (ServiceRegistryClient, error) {
 	switch strings.ToLower(clientType) {
 	case "http":
-		return NewHTTPRegistryClient(address), nil
+		return NewHTTPRegistryClient(address, tlsConfig), nil
 	case "grpc":
-		return NewGRPCRegistryClient(address)
+		return NewGRPCRegistryClient(address, tlsConfig)
 	default:
 		return nil, fmt.Errorf("unsupported service registry client type: %s", clientType)
 	}
@@ -40,6 +48,7 @@ func NewServiceRegistryClient(clientType string, address string) (ServiceRegistr
 type HTTPRegistryClient struct {
 	registryURL string
 	httpClient  *http.Client
+	watchClient *http.Client // without a timeout, for the long-lived event stream
 }
 
 type GRPCRegistryClient struct {
@@ -47,22 +56,37 @@ type GRPCRegistryClient struct {
 	client pb.ServiceRegistryClient
 }
 
-func NewHTTPRegistryClient(url string) *HTTPRegistryClient {
+// tlsConfig applies to https:// registry URLs, nil uses the system roots
+func NewHTTPRegistryClient(url string, tlsConfig *tls.Config) *HTTPRegistryClient {
+	transport := http.DefaultTransport
+	if tlsConfig != nil {
+		t := http.DefaultTransport.(*http.Transport).Clone()
+		t.TLSClientConfig = tlsConfig
+		transport = t
+	}
 	return &HTTPRegistryClient{
 		registryURL: url,
 		httpClient: &http.Client{
 			Timeout: 5 * time.Second,
+			Transport: transport,
+		},
+		watchClient: &http.Client{
+			Transport: transport,
 		},
 	}
 }
 
+// default scheme is http
+func (c *HTTPRegistryClient) baseURL() string {
+	if !strings.HasPrefix(c.registryURL, "http://") && !strings.HasPrefix(c.registryURL, "https://") {
+		return "http://" + c.registryURL
+	}
+	return c.registryURL
+}
+
 // fetch list of healthy services from the service registry via HTTP
 func (c *HTTPRegistryClient) GetServices() ([]ServiceInstance, error) {
-	fetchURL := c.registryURL
-	// default scheme is http
-	if !strings.HasPrefix(fetchURL, "http://") && !strings.HasPrefix(fetchURL, "https://") {
-		fetchURL = "http://" + fetchURL
-	}
+	fetchURL := c.baseURL()
 
 	resp, err := c.httpClient.Get(fmt.Sprintf("%s/api/v1/services", fetchURL))
 	if err != nil {
@@ -82,9 +106,15 @@ func (c *HTTPRegistryClient) GetServices() ([]ServiceInstance, error) {
 	return services, nil
 }
 
-func NewGRPCRegistryClient(address string) (*GRPCRegistryClient, error) {
+func NewGRPCRegistryClient(address string, tlsConfig *tls.Config) (*GRPCRegistryClient, error) {
+	// without TLS settings the connection stays unencrypted and unauthenticated, as registries started without certificates expect
+	transportCredentials := insecure.NewCredentials()
+	if tlsConfig != nil {
+		transportCredentials = credentials.NewTLS(tlsConfig)
+	}
+
 	// host:port prefix in address is to be used instead of "http://"
-	conn, err := grpc.NewClient(address, grpc.WithTransportCredentials(insecure.NewCredentials())) // unencrypted and unauthenticated gRPC connection to avoid need for TLS certificates, temporarily
+	conn, err := grpc.NewClient(address, grpc.WithTransportCredentials(transportCredentials))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create gRPC client at %s: %s", address, err)
 	}
@@ -106,15 +136,22 @@ func (c *GRPCRegistryClient) GetServices() ([]ServiceInstance, error) {
 
 	var instances []ServiceInstance
 	for _, s := range resp.GetServices() {
-		instances = append(instances, ServiceInstance{
-			ID: s.Id,
-			URL: s.Url,
-			HealthPath: s.HealthPath,
-		})
+		instances = append(instances, instanceFromProto(s))
 	}
 	return instances, nil
 }
 
+func instanceFromProto(s *pb.GrpcServiceInstance) ServiceInstance {
+	return ServiceInstance{
+		ID: s.Id,
+		ServiceName: s.ServiceName,
+		URL: s.Url,
+		HealthPath: s.HealthPath,
+		Weight: int(s.Weight),
+		Metadata: s.Metadata,
+	}
+}
+
 func (c *GRPCRegistryClient) Close() error {
 	if c.conn != nil {
 		log.Println("Closing gRPC registry client connection")
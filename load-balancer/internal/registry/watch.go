@@ -0,0 +1,166 @@
+package registry
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	pb "github.com/lokeshllkumar/load-balancer/internal/proto"
+)
+
+type ServiceEventType int
+
+const (
+	ServiceAdded ServiceEventType = iota
+	ServiceUpdated
+	ServiceRemoved
+	ServicesSynced // every instance healthy when the watch started has been sent
+)
+
+func (t ServiceEventType) String() string {
+	switch t {
+	case ServiceAdded:
+		return "added"
+	case ServiceUpdated:
+		return "updated"
+	case ServiceRemoved:
+		return "removed"
+	case ServicesSynced:
+		return "synced"
+	default:
+		return "unknown"
+	}
+}
+
+type ServiceEvent struct {
+	Type     ServiceEventType
+	Instance ServiceInstance // empty for ServicesSynced
+}
+
+// server-sent events from the registry, one "event: <type>" and "data: <instance JSON>" pair per change
+func (c *HTTPRegistryClient) WatchServices(ctx context.Context) (<-chan ServiceEvent, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/api/v1/services/watch", c.baseURL()), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create watch request: %w", err)
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	resp, err := c.watchClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to watch HTTP service registry at %s: %w", c.baseURL(), err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, fmt.Errorf("HTTP service registry watch returned non-OK status: %d, body: %s", resp.StatusCode, string(bodyBytes))
+	}
+
+	events := make(chan ServiceEvent)
+	go func() {
+		defer close(events)
+		defer resp.Body.Close()
+
+		var eventName, data string
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case strings.HasPrefix(line, "event:"):
+				eventName = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+			case strings.HasPrefix(line, "data:"):
+				data += strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+			case line == "":
+				// a blank line dispatches the event collected so far
+				if eventName != "" {
+					event, err := parseSSEEvent(eventName, data)
+					if err != nil {
+						log.Printf("Ignoring malformed registry watch event: %v", err)
+					} else {
+						select {
+						case events <- event:
+						case <-ctx.Done():
+							return
+						}
+					}
+				}
+				eventName, data = "", ""
+			}
+		}
+		if err := scanner.Err(); err != nil && ctx.Err() == nil {
+			log.Printf("HTTP service registry watch stream broke: %v", err)
+		}
+	}()
+	return events, nil
+}
+
+func parseSSEEvent(eventName string, data string) (ServiceEvent, error) {
+	var event ServiceEvent
+	switch eventName {
+	case "added":
+		event.Type = ServiceAdded
+	case "updated":
+		event.Type = ServiceUpdated
+	case "removed":
+		event.Type = ServiceRemoved
+	case "synced":
+		return ServiceEvent{Type: ServicesSynced}, nil
+	default:
+		return event, fmt.Errorf("unknown event type %q", eventName)
+	}
+
+	if err := json.Unmarshal([]byte(data), &event.Instance); err != nil {
+		return event, fmt.Errorf("failed to decode %s event: %w", eventName, err)
+	}
+	return event, nil
+}
+
+func (c *GRPCRegistryClient) WatchServices(ctx context.Context) (<-chan ServiceEvent, error) {
+	stream, err := c.client.WatchServices(ctx, &pb.WatchServicesRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("gRPC call to watch services failed: %w", err)
+	}
+
+	events := make(chan ServiceEvent)
+	go func() {
+		defer close(events)
+		for {
+			msg, err := stream.Recv()
+			if err != nil {
+				if err != io.EOF && ctx.Err() == nil {
+					log.Printf("gRPC service registry watch stream broke: %v", err)
+				}
+				return
+			}
+
+			var event ServiceEvent
+			switch msg.GetType() {
+			case pb.ServiceEvent_ADDED:
+				event.Type = ServiceAdded
+			case pb.ServiceEvent_UPDATED:
+				event.Type = ServiceUpdated
+			case pb.ServiceEvent_REMOVED:
+				event.Type = ServiceRemoved
+			case pb.ServiceEvent_SYNCED:
+				event.Type = ServicesSynced
+			default:
+				log.Printf("Ignoring registry watch event of unknown type %v", msg.GetType())
+				continue
+			}
+			if s := msg.GetInstance(); s != nil {
+				event.Instance = instanceFromProto(s)
+			}
+
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return events, nil
+}
@@ -0,0 +1,95 @@
+package router
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/lokeshllkumar/load-balancer/internal/config"
+)
+
+type Route struct {
+	host       string // exact host, or a "*.example.com" wildcard
+	pathPrefix string
+	pathRegex  *regexp.Regexp
+	methods    map[string]bool
+	handler    http.Handler
+}
+
+func (rt *Route) matches(req *http.Request) bool {
+	if rt.host != "" && !matchHost(rt.host, req.Host) {
+		return false
+	}
+	if rt.pathPrefix != "" && !strings.HasPrefix(req.URL.Path, rt.pathPrefix) {
+		return false
+	}
+	if rt.pathRegex != nil && !rt.pathRegex.MatchString(req.URL.Path) {
+		return false
+	}
+	if len(rt.methods) > 0 && !rt.methods[req.Method] {
+		return false
+	}
+	return true
+}
+
+func matchHost(pattern string, host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+
+	if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+		return strings.HasSuffix(host, "."+suffix)
+	}
+	return host == pattern
+}
+
+// dispatches requests to the handler of the first matching route, in the order the routes were added
+type Router struct {
+	routes []*Route
+}
+
+func NewRouter() *Router {
+	return &Router{
+		routes: make([]*Route, 0),
+	}
+}
+
+func (r *Router) AddRoute(cfg config.RouteConfig, handler http.Handler) error {
+	route := &Route{
+		host:       strings.ToLower(cfg.Host),
+		pathPrefix: cfg.PathPrefix,
+		handler:    handler,
+	}
+	if cfg.PathRegex != "" {
+		re, err := regexp.Compile(cfg.PathRegex)
+		if err != nil {
+			return fmt.Errorf("invalid path regex %q: %w", cfg.PathRegex, err)
+		}
+		route.pathRegex = re
+	}
+	if len(cfg.Methods) > 0 {
+		route.methods = make(map[string]bool, len(cfg.Methods))
+		for _, m := range cfg.Methods {
+			route.methods[strings.ToUpper(m)] = true
+		}
+	}
+
+	r.routes = append(r.routes, route)
+	return nil
+}
+
+func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	for _, route := range r.routes {
+		if route.matches(req) {
+			route.handler.ServeHTTP(w, req)
+			return
+		}
+	}
+
+	log.Printf("No route matched request %s %s%s", req.Method, req.Host, req.URL.Path)
+	http.Error(w, "No route matched the request", http.StatusNotFound)
+}
@@ -0,0 +1,176 @@
+package sessionstore
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// the log is rewritten with only the live entries once it holds this many records beyond twice their number
+const compactionSlack = 1000
+
+// a MemoryStore whose changes are appended to a write-ahead log of JSON lines, replayed on open,
+// so affinity survives restarts; writes reach the OS right away and are synced to disk on Close
+type FileStore struct {
+	*MemoryStore
+	path    string
+	walMu   sync.Mutex
+	file    *os.File
+	records int
+}
+
+func NewFileStore(path string, maxEntries int) (*FileStore, error) {
+	f := &FileStore{
+		MemoryStore: NewMemoryStore(maxEntries),
+		path:        path,
+	}
+	if err := f.replay(); err != nil {
+		return nil, err
+	}
+	// starts from a compacted log, dropping what expired while the load balancer was down
+	if err := f.compact(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *FileStore) replay() error {
+	file, err := os.Open(f.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open session log: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	replayed, skipped := 0, 0
+	for scanner.Scan() {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// most likely a line cut short by a crash, the rest of the log is still usable
+			skipped++
+			continue
+		}
+		f.MemoryStore.apply(entry)
+		replayed++
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read session log: %w", err)
+	}
+	log.Printf("Replayed %d session log record(s) from %s (%d unreadable), %d session(s) live", replayed, f.path, skipped, f.Len())
+	return nil
+}
+
+func (f *FileStore) Put(sessionID string, instanceID string, ttl time.Duration) {
+	entry := newEntry(sessionID, instanceID, ttl)
+	f.MemoryStore.write(entry)
+	f.append(entry)
+}
+
+func (f *FileStore) Delete(sessionID string) {
+	entry := tombstone(sessionID)
+	f.MemoryStore.write(entry)
+	f.append(entry)
+}
+
+func (f *FileStore) Apply(entry Entry) {
+	if f.MemoryStore.apply(entry) {
+		f.append(entry)
+	}
+}
+
+func (f *FileStore) append(entry Entry) {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		log.Printf("Failed to encode session %s: %v", entry.SessionID, err)
+		return
+	}
+
+	f.walMu.Lock()
+	defer f.walMu.Unlock()
+	if f.file == nil {
+		return
+	}
+	if _, err := f.file.Write(append(line, '\n')); err != nil {
+		log.Printf("Failed to append to session log %s: %v", f.path, err)
+		return
+	}
+	f.records++
+	if f.records > 2*f.Len()+compactionSlack {
+		if err := f.compactLocked(); err != nil {
+			log.Printf("Failed to compact session log %s: %v", f.path, err)
+		}
+	}
+}
+
+func (f *FileStore) compact() error {
+	f.walMu.Lock()
+	defer f.walMu.Unlock()
+	return f.compactLocked()
+}
+
+// writes the live entries to a new file and swaps it in, so a crash midway leaves the old log intact
+func (f *FileStore) compactLocked() error {
+	entries := f.Entries()
+	tmpPath := f.path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(tmp)
+	for _, entry := range entries {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			continue
+		}
+		writer.Write(append(line, '\n'))
+	}
+	if err := writer.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	tmp.Close()
+	if err := os.Rename(tmpPath, f.path); err != nil {
+		return err
+	}
+	if dir, err := os.Open(filepath.Dir(f.path)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+
+	if f.file != nil {
+		f.file.Close()
+	}
+	f.file, err = os.OpenFile(f.path, os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	f.records = len(entries)
+	return nil
+}
+
+func (f *FileStore) Close() error {
+	f.walMu.Lock()
+	defer f.walMu.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Sync()
+	if closeErr := f.file.Close(); err == nil {
+		err = closeErr
+	}
+	f.file = nil
+	return err
+}
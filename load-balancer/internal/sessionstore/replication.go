@@ -0,0 +1,187 @@
+package sessionstore
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	ReplicationPath = "/api/v1/sessions/replicate"
+
+	replicationTokenHeader = "X-Replication-Token"
+	replicationQueueSize   = 10000
+	replicationBatchSize   = 100
+	replicationInterval    = 100 * time.Millisecond
+	replicationTimeout     = 5 * time.Second
+	maxReplicationBody     = 16 << 20
+)
+
+type ReplicatorOptions struct {
+	Peers []string // base URLs of the other replicas' replication listeners, e.g. http://10.0.0.2:9095
+	Token string   // sent to and required from peers; unset refuses every peer
+}
+
+type replicationBatch struct {
+	Entries []Entry `json:"entries"`
+}
+
+// pushes local session changes to every peer in small batches and applies the ones peers push;
+// delivery is best effort, a peer that was unreachable catches up from the others' entries when it starts
+type Replicator struct {
+	store   Store
+	options ReplicatorOptions
+	client  *http.Client
+	queue   chan Entry
+}
+
+func NewReplicator(store Store, options ReplicatorOptions) *Replicator {
+	peers := make([]string, 0, len(options.Peers))
+	for _, peer := range options.Peers {
+		peers = append(peers, strings.TrimSuffix(peer, "/"))
+	}
+	options.Peers = peers
+	r := &Replicator{
+		store:   store,
+		options: options,
+		client:  &http.Client{Timeout: replicationTimeout},
+		queue:   make(chan Entry, replicationQueueSize),
+	}
+	store.SetReplicationHook(r.enqueue)
+	return r
+}
+
+func (r *Replicator) enqueue(entry Entry) {
+	select {
+	case r.queue <- entry:
+	default:
+		log.Printf("Session replication queue full, dropping update for session %s", entry.SessionID)
+	}
+}
+
+// pulls the peers' sessions once, then sends local changes until ctx is cancelled
+func (r *Replicator) Start(ctx context.Context) {
+	for _, peer := range r.options.Peers {
+		if err := r.bootstrap(ctx, peer); err != nil {
+			log.Printf("Failed to fetch sessions from peer %s: %v", peer, err)
+		}
+	}
+
+	ticker := time.NewTicker(replicationInterval)
+	defer ticker.Stop()
+	batch := make([]Entry, 0, replicationBatchSize)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case entry := <-r.queue:
+			batch = append(batch, entry)
+			if len(batch) < replicationBatchSize {
+				continue
+			}
+		case <-ticker.C:
+			if len(batch) == 0 {
+				continue
+			}
+		}
+		for _, peer := range r.options.Peers {
+			if err := r.push(ctx, peer, batch); err != nil {
+				log.Printf("Failed to replicate %d session update(s) to peer %s: %v", len(batch), peer, err)
+			}
+		}
+		batch = batch[:0]
+	}
+}
+
+func (r *Replicator) push(ctx context.Context, peer string, entries []Entry) error {
+	body, err := json.Marshal(replicationBatch{Entries: entries})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, peer+ReplicationPath, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	_, err = r.do(req)
+	return err
+}
+
+func (r *Replicator) bootstrap(ctx context.Context, peer string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, peer+ReplicationPath, nil)
+	if err != nil {
+		return err
+	}
+	body, err := r.do(req)
+	if err != nil {
+		return err
+	}
+	var batch replicationBatch
+	if err := json.Unmarshal(body, &batch); err != nil {
+		return fmt.Errorf("invalid response: %w", err)
+	}
+	for _, entry := range batch.Entries {
+		r.store.Apply(entry)
+	}
+	log.Printf("Fetched %d session(s) from peer %s", len(batch.Entries), peer)
+	return nil
+}
+
+func (r *Replicator) do(req *http.Request) ([]byte, error) {
+	if r.options.Token != "" {
+		req.Header.Set(replicationTokenHeader, r.options.Token)
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxReplicationBody))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return body, nil
+}
+
+// POST applies a peer's batch, GET returns every live session for a peer that is starting
+func (r *Replicator) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != ReplicationPath {
+			http.NotFound(w, req)
+			return
+		}
+		if r.options.Token == "" || subtle.ConstantTimeCompare([]byte(req.Header.Get(replicationTokenHeader)), []byte(r.options.Token)) != 1 {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		switch req.Method {
+		case http.MethodGet:
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(replicationBatch{Entries: r.store.Entries()})
+		case http.MethodPost:
+			var batch replicationBatch
+			if err := json.NewDecoder(io.LimitReader(req.Body, maxReplicationBody)).Decode(&batch); err != nil {
+				http.Error(w, fmt.Sprintf("invalid batch: %v", err), http.StatusBadRequest)
+				return
+			}
+			for _, entry := range batch.Entries {
+				r.store.Apply(entry)
+			}
+			w.WriteHeader(http.StatusOK)
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
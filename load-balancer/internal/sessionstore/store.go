@@ -0,0 +1,182 @@
+package sessionstore
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+const defaultMaxEntries = 100000
+
+// a session's backend assignment, or its removal; also the unit of the WAL and of replication
+type Entry struct {
+	SessionID  string    `json:"sessionId"`
+	InstanceID string    `json:"instanceId,omitempty"`
+	Expires    time.Time `json:"expires"`
+	Updated    time.Time `json:"updated"` // the newer write wins when replicas disagree
+	Deleted    bool      `json:"deleted,omitempty"`
+}
+
+func (e Entry) expired(now time.Time) bool {
+	return !now.Before(e.Expires)
+}
+
+// maps sticky session IDs to backend instance IDs
+type Store interface {
+	Get(sessionID string) (instanceID string, found bool)
+	Put(sessionID string, instanceID string, ttl time.Duration)
+	Delete(sessionID string)
+	// applies a change made on another replica, unless the local entry is newer; the hook is not called for it
+	Apply(entry Entry)
+	// the live entries, for replicas catching up
+	Entries() []Entry
+	// called with every local change, after it is applied
+	SetReplicationHook(hook func(Entry))
+	Close() error
+}
+
+// LRU of sessions with a per-entry expiry; the least recently used entry is evicted once maxEntries is reached
+type MemoryStore struct {
+	mu         sync.Mutex
+	maxEntries int
+	entries    map[string]*list.Element
+	lru        *list.List // front is the most recently used
+	hook       func(Entry)
+}
+
+func NewMemoryStore(maxEntries int) *MemoryStore {
+	if maxEntries <= 0 {
+		maxEntries = defaultMaxEntries
+	}
+	return &MemoryStore{
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		lru:        list.New(),
+	}
+}
+
+func (m *MemoryStore) Get(sessionID string) (string, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	element, found := m.entries[sessionID]
+	if !found {
+		return "", false
+	}
+	entry := element.Value.(Entry)
+	if entry.expired(time.Now()) {
+		m.remove(element)
+		return "", false
+	}
+	m.lru.MoveToFront(element)
+	return entry.InstanceID, true
+}
+
+func (m *MemoryStore) Put(sessionID string, instanceID string, ttl time.Duration) {
+	m.write(newEntry(sessionID, instanceID, ttl))
+}
+
+func (m *MemoryStore) Delete(sessionID string) {
+	m.write(tombstone(sessionID))
+}
+
+func newEntry(sessionID string, instanceID string, ttl time.Duration) Entry {
+	now := time.Now()
+	return Entry{SessionID: sessionID, InstanceID: instanceID, Expires: now.Add(ttl), Updated: now}
+}
+
+func tombstone(sessionID string) Entry {
+	now := time.Now()
+	return Entry{SessionID: sessionID, Expires: now, Updated: now, Deleted: true}
+}
+
+// applies a local change and passes it to the replication hook
+func (m *MemoryStore) write(entry Entry) {
+	m.mu.Lock()
+	if entry.Deleted {
+		if element, found := m.entries[entry.SessionID]; found {
+			m.remove(element)
+		}
+	} else {
+		m.set(entry)
+	}
+	hook := m.hook
+	m.mu.Unlock()
+
+	if hook != nil {
+		hook(entry)
+	}
+}
+
+func (m *MemoryStore) Apply(entry Entry) {
+	m.apply(entry)
+}
+
+// reports whether the entry was newer than the local one and so changed the store
+func (m *MemoryStore) apply(entry Entry) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	element, found := m.entries[entry.SessionID]
+	if found && !element.Value.(Entry).Updated.Before(entry.Updated) {
+		return false
+	}
+	if entry.Deleted || entry.expired(time.Now()) {
+		if found {
+			m.remove(element)
+		}
+		return found
+	}
+	m.set(entry)
+	return true
+}
+
+func (m *MemoryStore) Entries() []Entry {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	entries := make([]Entry, 0, m.lru.Len())
+	// oldest first, so replaying them in order keeps the recency order
+	for element := m.lru.Back(); element != nil; element = element.Prev() {
+		if entry := element.Value.(Entry); !entry.expired(now) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+func (m *MemoryStore) SetReplicationHook(hook func(Entry)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.hook = hook
+}
+
+func (m *MemoryStore) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.lru.Len()
+}
+
+func (m *MemoryStore) Close() error {
+	return nil
+}
+
+// must be called with mu held
+func (m *MemoryStore) set(entry Entry) {
+	if element, found := m.entries[entry.SessionID]; found {
+		element.Value = entry
+		m.lru.MoveToFront(element)
+		return
+	}
+	if m.lru.Len() >= m.maxEntries {
+		m.remove(m.lru.Back())
+	}
+	m.entries[entry.SessionID] = m.lru.PushFront(entry)
+}
+
+// must be called with mu held
+func (m *MemoryStore) remove(element *list.Element) {
+	m.lru.Remove(element)
+	delete(m.entries, element.Value.(Entry).SessionID)
+}
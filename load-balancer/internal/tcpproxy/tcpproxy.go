@@ -0,0 +1,291 @@
+package tcpproxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lokeshllkumar/load-balancer/internal/balancer"
+	"github.com/lokeshllkumar/load-balancer/internal/metrics"
+	"github.com/lokeshllkumar/load-balancer/internal/proxyproto"
+)
+
+const (
+	defaultConnectTimeout = 5 * time.Second
+	// backends tried per connection before giving up; nothing has been sent yet, so every attempt is safe
+	maxConnectAttempts = 3
+	spliceBufferSize   = 32 * 1024
+)
+
+type Options struct {
+	Name              string
+	Address           string
+	Service           string
+	ConnectTimeout    time.Duration
+	IdleTimeout       time.Duration // 0 never closes idle connections
+	TrustedProxies    []*net.IPNet  // peers whose connections start with a PROXY protocol header
+	SendProxyProtocol int           // header version sent to backends, 0 sends none
+}
+
+// accepts connections and splices each one to a backend picked by the service's strategy
+type Listener struct {
+	options  Options
+	resolve  balancer.StrategyResolver
+	listener net.Listener
+	mu       sync.Mutex
+	conns    map[net.Conn]struct{}
+	wg       sync.WaitGroup
+	closed   atomic.Bool
+}
+
+func NewListener(options Options, resolve balancer.StrategyResolver) *Listener {
+	if options.ConnectTimeout <= 0 {
+		options.ConnectTimeout = defaultConnectTimeout
+	}
+	return &Listener{
+		options: options,
+		resolve: resolve,
+		conns:   make(map[net.Conn]struct{}),
+	}
+}
+
+func (l *Listener) Addr() string {
+	return l.options.Address
+}
+
+func (l *Listener) ListenAndServe() error {
+	listener, err := net.Listen("tcp", l.options.Address)
+	if err != nil {
+		return err
+	}
+	if len(l.options.TrustedProxies) > 0 {
+		listener = proxyproto.NewListener(listener, l.options.TrustedProxies)
+	}
+	l.mu.Lock()
+	l.listener = listener
+	l.mu.Unlock()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if l.closed.Load() {
+				return nil
+			}
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				log.Printf("TCP listener %q failed to accept a connection: %v", l.options.Name, err)
+				time.Sleep(10 * time.Millisecond)
+				continue
+			}
+			return err
+		}
+
+		l.track(conn, true)
+		l.wg.Add(1)
+		go func() {
+			defer l.wg.Done()
+			defer l.track(conn, false)
+			l.handle(conn)
+		}()
+	}
+}
+
+func (l *Listener) track(conn net.Conn, add bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if add {
+		l.conns[conn] = struct{}{}
+	} else {
+		delete(l.conns, conn)
+	}
+}
+
+// stops accepting, then waits for open connections to finish until ctx is done and closes the rest
+func (l *Listener) Shutdown(ctx context.Context) error {
+	l.closed.Store(true)
+	l.mu.Lock()
+	if l.listener != nil {
+		l.listener.Close()
+	}
+	l.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		l.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+	}
+
+	l.mu.Lock()
+	remaining := len(l.conns)
+	for conn := range l.conns {
+		conn.Close()
+	}
+	l.mu.Unlock()
+	<-done
+	return fmt.Errorf("closed %d connection(s) still open on TCP listener %q", remaining, l.options.Name)
+}
+
+func (l *Listener) handle(client net.Conn) {
+	defer client.Close()
+
+	strategy := l.resolve(l.options.Service)
+	if strategy == nil {
+		log.Printf("TCP listener %q: service %q is no longer configured, closing connection from %s", l.options.Name, l.options.Service, client.RemoteAddr())
+		metrics.TCPConnectionsTotal.WithLabelValues(l.options.Name, "no_backend").Inc()
+		return
+	}
+
+	backend, upstream := l.connect(client, strategy)
+	if upstream == nil {
+		return
+	}
+	defer upstream.Close()
+	metrics.TCPConnectionsTotal.WithLabelValues(l.options.Name, "proxied").Inc()
+
+	backend.IncrementConnections()
+	defer backend.DecrementConnections()
+
+	log.Printf("TCP listener %q routing %s to backend %s (ID: %s)", l.options.Name, client.RemoteAddr(), backend.URL.Host, backend.InstanceID)
+	l.splice(client, upstream, backend)
+}
+
+// picks and dials backends until one accepts the connection, and the PROXY protocol header if one is sent;
+// each attempt reports exactly one result to the backend's circuit breaker
+func (l *Listener) connect(client net.Conn, strategy balancer.LoadBalancingStrategy) (*balancer.Backend, net.Conn) {
+	req := balancer.ConnectionRequest(client.RemoteAddr().String())
+	dialFailed := false
+	for attempt := 0; attempt < maxConnectAttempts; attempt++ {
+		backend := strategy.SelectBackend(req)
+		if backend == nil {
+			break
+		}
+		req = req.WithContext(balancer.WithExcludedBackend(req.Context(), backend))
+
+		if !backend.AllowRequest() {
+			log.Printf("Circuit breaker for backend %s (ID: %s) rejected the connection", backend.URL.Host, backend.InstanceID)
+			attempt--
+			continue
+		}
+
+		start := time.Now()
+		upstream, err := net.DialTimeout("tcp", backend.URL.Host, l.options.ConnectTimeout)
+		if err != nil {
+			log.Printf("TCP listener %q failed to connect to backend %s (ID: %s): %v", l.options.Name, backend.URL.Host, backend.InstanceID, err)
+			backend.RecordError()
+			dialFailed = true
+			continue
+		}
+		// the connect time stands in for latency, the length of a connection says nothing about the backend
+		connectTime := time.Since(start)
+		if err := l.sendProxyHeader(client, upstream); err != nil {
+			log.Printf("TCP listener %q failed to send PROXY protocol header to backend %s (ID: %s): %v", l.options.Name, backend.URL.Host, backend.InstanceID, err)
+			upstream.Close()
+			backend.RecordError()
+			dialFailed = true
+			continue
+		}
+		backend.RecordLatency(connectTime)
+		backend.RecordSuccess()
+		return backend, upstream
+	}
+
+	log.Printf("TCP listener %q has no backend available for %s", l.options.Name, client.RemoteAddr())
+	if dialFailed {
+		metrics.TCPConnectionsTotal.WithLabelValues(l.options.Name, "connect_failed").Inc()
+	} else {
+		metrics.TCPConnectionsTotal.WithLabelValues(l.options.Name, "no_backend").Inc()
+	}
+	return nil, nil
+}
+
+// nothing is sent unless the listener is configured to
+func (l *Listener) sendProxyHeader(client net.Conn, upstream net.Conn) error {
+	if l.options.SendProxyProtocol == 0 {
+		return nil
+	}
+	// the client and destination as this listener saw them, or as reported by a trusted proxy in front of it
+	header, err := proxyproto.FormatHeader(l.options.SendProxyProtocol, client.RemoteAddr(), client.LocalAddr())
+	if err != nil {
+		return err
+	}
+	_, err = upstream.Write(header)
+	return err
+}
+
+// copies in both directions until both sides are done; an end of stream on one side is passed on as a half-close
+func (l *Listener) splice(client net.Conn, upstream net.Conn, backend *balancer.Backend) {
+	var lastActivity atomic.Int64
+	lastActivity.Store(time.Now().UnixNano())
+
+	done := make(chan struct{}, 2)
+	go func() {
+		n := l.pipe(upstream, client, &lastActivity)
+		metrics.TCPBytesTotal.WithLabelValues(l.options.Name, backend.InstanceID, "upstream").Add(float64(n))
+		done <- struct{}{}
+	}()
+	go func() {
+		n := l.pipe(client, upstream, &lastActivity)
+		metrics.TCPBytesTotal.WithLabelValues(l.options.Name, backend.InstanceID, "downstream").Add(float64(n))
+		done <- struct{}{}
+	}()
+	<-done
+	<-done
+}
+
+func (l *Listener) pipe(dst net.Conn, src net.Conn, lastActivity *atomic.Int64) int64 {
+	buf := make([]byte, spliceBufferSize)
+	var written int64
+	for {
+		if l.options.IdleTimeout > 0 {
+			src.SetReadDeadline(time.Now().Add(l.options.IdleTimeout))
+		}
+		n, err := src.Read(buf)
+		if n > 0 {
+			lastActivity.Store(time.Now().UnixNano())
+			if _, werr := dst.Write(buf[:n]); werr != nil {
+				src.Close()
+				return written
+			}
+			written += int64(n)
+		}
+		if err == nil {
+			continue
+		}
+
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			// traffic in the other direction keeps the connection open
+			idle := time.Since(time.Unix(0, lastActivity.Load()))
+			if idle < l.options.IdleTimeout {
+				continue
+			}
+			log.Printf("TCP listener %q closing connection idle for %v", l.options.Name, idle.Round(time.Second))
+		}
+		if err == io.EOF {
+			closeWrite(dst)
+		} else {
+			dst.Close()
+			src.Close()
+		}
+		return written
+	}
+}
+
+func closeWrite(conn net.Conn) {
+	if closer, ok := conn.(interface{ CloseWrite() error }); ok {
+		closer.CloseWrite()
+		return
+	}
+	conn.Close()
+}
@@ -0,0 +1,126 @@
+package tlsutil
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// how often certificate files are checked for changes unless configured otherwise
+const DefaultCertReloadInterval = 10 * time.Second
+
+type KeyPair struct {
+	CertFile string
+	KeyFile  string
+}
+
+// serving certificates picked by SNI, reloaded from disk when their files change;
+// a pair that fails to load keeps the previously loaded certificate
+type CertStore struct {
+	pairs        []KeyPair
+	certificates atomic.Pointer[[]*tls.Certificate]
+	modTimes     []time.Time
+}
+
+func NewCertStore(pairs []KeyPair) (*CertStore, error) {
+	if len(pairs) == 0 {
+		return nil, fmt.Errorf("at least one certificate is required")
+	}
+
+	cs := &CertStore{
+		pairs:    pairs,
+		modTimes: make([]time.Time, len(pairs)),
+	}
+	certificates := make([]*tls.Certificate, len(pairs))
+	for i, pair := range pairs {
+		cert, err := loadKeyPair(pair)
+		if err != nil {
+			return nil, err
+		}
+		certificates[i] = cert
+		cs.modTimes[i] = pairModTime(pair)
+	}
+	cs.certificates.Store(&certificates)
+	return cs, nil
+}
+
+func loadKeyPair(pair KeyPair) (*tls.Certificate, error) {
+	cert, err := tls.LoadX509KeyPair(pair.CertFile, pair.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load certificate %s: %w", pair.CertFile, err)
+	}
+	// parsed up front so SNI matching does not have to on every handshake
+	if cert.Leaf == nil {
+		cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse certificate %s: %w", pair.CertFile, err)
+		}
+	}
+	return &cert, nil
+}
+
+// the later of the two files' modification times
+func pairModTime(pair KeyPair) time.Time {
+	var latest time.Time
+	for _, path := range []string{pair.CertFile, pair.KeyFile} {
+		if info, err := os.Stat(path); err == nil && info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest
+}
+
+// for tls.Config.GetCertificate; the first certificate the client supports wins, the first configured one otherwise
+func (cs *CertStore) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	certificates := *cs.certificates.Load()
+	for _, cert := range certificates {
+		if hello.SupportsCertificate(cert) == nil {
+			return cert, nil
+		}
+	}
+	return certificates[0], nil
+}
+
+// reloads the pairs whose files changed since they were last loaded
+func (cs *CertStore) reloadChanged() {
+	certificates := append([]*tls.Certificate(nil), *cs.certificates.Load()...)
+	changed := false
+	for i, pair := range cs.pairs {
+		modTime := pairModTime(pair)
+		if modTime.Equal(cs.modTimes[i]) {
+			continue
+		}
+
+		cert, err := loadKeyPair(pair)
+		if err != nil {
+			// possibly caught between writing the certificate and the key; retried on the next tick
+			log.Printf("Failed to reload certificate, keeping the current one: %v", err)
+			continue
+		}
+		certificates[i] = cert
+		cs.modTimes[i] = modTime
+		changed = true
+		log.Printf("Reloaded certificate %s (expires %s)", pair.CertFile, cert.Leaf.NotAfter.Format(time.RFC3339))
+	}
+	if changed {
+		cs.certificates.Store(&certificates)
+	}
+}
+
+func (cs *CertStore) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			cs.reloadChanged()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,348 @@
+package udpproxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/lokeshllkumar/load-balancer/internal/balancer"
+	"github.com/lokeshllkumar/load-balancer/internal/metrics"
+)
+
+const (
+	defaultSessionTimeout = 30 * time.Second
+	defaultMaxSessions    = 10000
+	maxDatagramSize       = 64 * 1024
+	maxPendingDatagrams   = 32 // per session while its backend is dialed, later ones are dropped
+)
+
+type Options struct {
+	Name           string
+	Address        string
+	Service        string
+	SessionTimeout time.Duration
+	MaxSessions    int // datagrams from new clients are dropped while this many sessions are open
+}
+
+// forwards datagrams from each client address to the backend its session was assigned,
+// and relays the backend's replies back from the listening socket
+type Listener struct {
+	options  Options
+	resolve  balancer.StrategyResolver
+	conn     *net.UDPConn
+	mu       sync.Mutex
+	sessions map[string]*session
+	full     bool // whether the session limit has been logged since it was last reached
+	wg       sync.WaitGroup
+	closed   atomic.Bool
+}
+
+// a client address bound to a backend, with its own connected socket so replies can be told apart;
+// backend, upstream and createdAt are set once when the session connects and never change after
+type session struct {
+	key          string
+	client       *net.UDPAddr
+	backend      *balancer.Backend
+	upstream     *net.UDPConn
+	createdAt    time.Time
+	lastActivity atomic.Int64
+	connected    atomic.Bool
+	mu           sync.Mutex  // guards pending until the session is connected
+	pending      [][]byte    // datagrams received while the backend was being picked and dialed
+	resulted     atomic.Bool // whether the backend's circuit breaker has been told how the session went
+}
+
+func (s *session) touch() {
+	s.lastActivity.Store(time.Now().UnixNano())
+}
+
+func (s *session) idle() time.Duration {
+	return time.Since(time.Unix(0, s.lastActivity.Load()))
+}
+
+// holds on to a datagram for a session that is still connecting; false once it has connected
+func (s *session) queue(datagram []byte) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.connected.Load() {
+		return false
+	}
+	if len(s.pending) < maxPendingDatagrams {
+		s.pending = append(s.pending, bytes.Clone(datagram))
+	}
+	return true
+}
+
+func (s *session) recordError() {
+	s.resulted.Store(true)
+	s.backend.RecordError()
+}
+
+func NewListener(options Options, resolve balancer.StrategyResolver) *Listener {
+	if options.SessionTimeout <= 0 {
+		options.SessionTimeout = defaultSessionTimeout
+	}
+	if options.MaxSessions <= 0 {
+		options.MaxSessions = defaultMaxSessions
+	}
+	return &Listener{
+		options:  options,
+		resolve:  resolve,
+		sessions: make(map[string]*session),
+	}
+}
+
+func (l *Listener) Addr() string {
+	return l.options.Address
+}
+
+func (l *Listener) ListenAndServe() error {
+	addr, err := net.ResolveUDPAddr("udp", l.options.Address)
+	if err != nil {
+		return err
+	}
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	l.conn = conn
+	l.mu.Unlock()
+
+	buf := make([]byte, maxDatagramSize)
+	for {
+		n, client, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if l.closed.Load() {
+				return nil
+			}
+			return err
+		}
+
+		s := l.session(client)
+		if s == nil {
+			continue
+		}
+		s.touch()
+		if !s.connected.Load() && s.queue(buf[:n]) {
+			continue
+		}
+		l.forward(s, buf[:n])
+	}
+}
+
+func (l *Listener) forward(s *session, datagram []byte) {
+	if _, err := s.upstream.Write(datagram); err != nil {
+		if errors.Is(err, net.ErrClosed) {
+			// the session ended between the lookup and the write
+			return
+		}
+		log.Printf("UDP listener %q failed to forward to backend %s (ID: %s): %v", l.options.Name, s.backend.URL.Host, s.backend.InstanceID, err)
+		s.recordError()
+		// the relay ends the session once its socket is closed
+		s.upstream.Close()
+		return
+	}
+	metrics.UDPDatagramsTotal.WithLabelValues(l.options.Name, s.backend.InstanceID, "upstream").Inc()
+	metrics.UDPBytesTotal.WithLabelValues(l.options.Name, s.backend.InstanceID, "upstream").Add(float64(len(datagram)))
+}
+
+// the client's current session, or a new one connecting to a freshly picked backend in the background,
+// so a slow lookup of one backend holds up no other client; nil if the service is gone or the listener is full
+func (l *Listener) session(client *net.UDPAddr) *session {
+	key := client.String()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if s, found := l.sessions[key]; found {
+		// a backend that went down, or was drained, disabled, ejected or had its circuit opened,
+		// is replaced right away rather than when the session expires
+		if !s.connected.Load() || s.backend.TakesTraffic() {
+			return s
+		}
+		delete(l.sessions, key)
+		s.upstream.Close()
+	}
+
+	// existing sessions are left alone, evicting them would let a flood of spoofed sources take over the listener
+	if len(l.sessions) >= l.options.MaxSessions {
+		metrics.UDPSessionsRejectedTotal.WithLabelValues(l.options.Name).Inc()
+		if !l.full {
+			log.Printf("UDP listener %q reached its limit of %d sessions, dropping datagrams from new clients", l.options.Name, l.options.MaxSessions)
+			l.full = true
+		}
+		return nil
+	}
+	l.full = false
+
+	strategy := l.resolve(l.options.Service)
+	if strategy == nil {
+		log.Printf("UDP listener %q: service %q is no longer configured, dropping datagram from %s", l.options.Name, l.options.Service, key)
+		return nil
+	}
+
+	s := &session{
+		key:    key,
+		client: client,
+	}
+	l.sessions[key] = s
+	l.wg.Add(1)
+	go l.connect(s, strategy)
+	return s
+}
+
+// binds the session to a backend, sends what the client has sent so far and relays replies until the session ends
+func (l *Listener) connect(s *session, strategy balancer.LoadBalancingStrategy) {
+	defer l.wg.Done()
+
+	backend, upstream := l.dial(s.key, strategy)
+	if upstream == nil {
+		l.mu.Lock()
+		if l.sessions[s.key] == s {
+			delete(l.sessions, s.key)
+		}
+		l.mu.Unlock()
+		return
+	}
+
+	s.mu.Lock()
+	s.backend = backend
+	s.upstream = upstream
+	s.createdAt = time.Now()
+	for _, datagram := range s.pending {
+		l.forward(s, datagram)
+	}
+	s.pending = nil
+	s.connected.Store(true)
+	s.mu.Unlock()
+
+	backend.IncrementConnections()
+	defer l.endSession(s)
+	// Shutdown only closes sessions that had connected when it looked
+	if l.closed.Load() {
+		return
+	}
+	log.Printf("UDP listener %q routing %s to backend %s (ID: %s)", l.options.Name, s.key, backend.URL.Host, backend.InstanceID)
+	l.relay(s)
+}
+
+// picks backends until a socket to one is open
+func (l *Listener) dial(key string, strategy balancer.LoadBalancingStrategy) (*balancer.Backend, *net.UDPConn) {
+	req := balancer.ConnectionRequest(key)
+	for {
+		backend := strategy.SelectBackend(req)
+		if backend == nil {
+			log.Printf("UDP listener %q has no backend available for %s", l.options.Name, key)
+			return nil, nil
+		}
+		req = req.WithContext(balancer.WithExcludedBackend(req.Context(), backend))
+
+		if !backend.AllowRequest() {
+			log.Printf("Circuit breaker for backend %s (ID: %s) rejected the session", backend.URL.Host, backend.InstanceID)
+			continue
+		}
+		backendAddr, err := net.ResolveUDPAddr("udp", backend.URL.Host)
+		if err != nil {
+			log.Printf("UDP listener %q failed to resolve backend %s (ID: %s): %v", l.options.Name, backend.URL.Host, backend.InstanceID, err)
+			backend.RecordError()
+			continue
+		}
+		upstream, err := net.DialUDP("udp", nil, backendAddr)
+		if err != nil {
+			log.Printf("UDP listener %q failed to open a socket to backend %s (ID: %s): %v", l.options.Name, backend.URL.Host, backend.InstanceID, err)
+			backend.RecordError()
+			continue
+		}
+		return backend, upstream
+	}
+}
+
+// sends the backend's replies to the client until the session times out or its socket is closed
+func (l *Listener) relay(s *session) {
+	buf := make([]byte, maxDatagramSize)
+	replied := false
+	for {
+		s.upstream.SetReadDeadline(time.Now().Add(l.options.SessionTimeout))
+		n, err := s.upstream.Read(buf)
+		if err != nil {
+			var netErr net.Error
+			switch {
+			case errors.As(err, &netErr) && netErr.Timeout():
+				// datagrams from the client keep the session open
+				if s.idle() < l.options.SessionTimeout {
+					continue
+				}
+			case errors.Is(err, syscall.ECONNREFUSED):
+				// an ICMP port unreachable from the backend
+				log.Printf("UDP listener %q: backend %s (ID: %s) refused datagrams", l.options.Name, s.backend.URL.Host, s.backend.InstanceID)
+				s.recordError()
+			}
+			return
+		}
+
+		if !replied {
+			// the first reply stands in for latency, the length of a session says nothing about the backend
+			s.backend.RecordLatency(time.Since(s.createdAt))
+			s.resulted.Store(true)
+			s.backend.RecordSuccess()
+			replied = true
+		}
+		s.touch()
+		if _, err := l.conn.WriteToUDP(buf[:n], s.client); err != nil {
+			log.Printf("UDP listener %q failed to relay a reply to %s: %v", l.options.Name, s.key, err)
+			continue
+		}
+		metrics.UDPDatagramsTotal.WithLabelValues(l.options.Name, s.backend.InstanceID, "downstream").Inc()
+		metrics.UDPBytesTotal.WithLabelValues(l.options.Name, s.backend.InstanceID, "downstream").Add(float64(n))
+	}
+}
+
+func (l *Listener) endSession(s *session) {
+	l.mu.Lock()
+	if l.sessions[s.key] == s {
+		delete(l.sessions, s.key)
+	}
+	l.mu.Unlock()
+
+	s.upstream.Close()
+	s.backend.DecrementConnections()
+	// one-way traffic, or replies that never made it back; says nothing either way about the backend
+	if !s.resulted.Load() {
+		s.backend.ReleaseRequest()
+	}
+}
+
+// stops receiving and ends every session; UDP has nothing in flight worth waiting for beyond ctx
+func (l *Listener) Shutdown(ctx context.Context) error {
+	l.closed.Store(true)
+	l.mu.Lock()
+	if l.conn != nil {
+		l.conn.Close()
+	}
+	remaining := len(l.sessions)
+	for _, s := range l.sessions {
+		if s.connected.Load() {
+			s.upstream.Close()
+		}
+	}
+	l.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		l.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("%d session(s) on UDP listener %q did not end in time", remaining, l.options.Name)
+	}
+}
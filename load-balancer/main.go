@@ -4,17 +4,25 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 
-	"github.com/lokeshllkumar/load-balancer/internal/balancer"
+	"github.com/lokeshllkumar/load-balancer/internal/admin"
+	"github.com/lokeshllkumar/load-balancer/internal/app"
 	"github.com/lokeshllkumar/load-balancer/internal/config"
+	"github.com/lokeshllkumar/load-balancer/internal/balancer"
 	"github.com/lokeshllkumar/load-balancer/internal/metrics"
-	"github.com/lokeshllkumar/load-balancer/internal/proxy"
-	"github.com/lokeshllkumar/load-balancer/internal/registry"
+	"github.com/lokeshllkumar/load-balancer/internal/netutil"
+	"github.com/lokeshllkumar/load-balancer/internal/proxyproto"
+	"github.com/lokeshllkumar/load-balancer/internal/sessionstore"
+	"github.com/lokeshllkumar/load-balancer/internal/tcpproxy"
+	"github.com/lokeshllkumar/load-balancer/internal/tlsutil"
+	"github.com/lokeshllkumar/load-balancer/internal/udpproxy"
 )
 
 func main() {
@@ -25,47 +33,146 @@ func main() {
 
 	metrics.InitMetrics()
 
-	serviceRegistryClient, err := registry.NewServiceRegistryClient(cfg.ServiceRegistryType, cfg.ServiceRegsistryUrl)
+	// the session store and its replication are set up once, changes need a restart
+	store, err := newSessionStore(cfg.SessionStore)
 	if err != nil {
-		log.Fatalf("Failed to initialize service registry client: %v", err)
+		log.Fatalf("Failed to open session store: %v", err)
 	}
-	if grpcClient, ok := serviceRegistryClient.(*registry.GRPCRegistryClient); ok {
-		defer grpcClient.Close()
+	var replicator *sessionstore.Replicator
+	if store != nil && len(cfg.SessionStore.Replication.Peers) > 0 {
+		replicator = sessionstore.NewReplicator(store, sessionstore.ReplicatorOptions{
+			Peers: cfg.SessionStore.Replication.Peers,
+			Token: cfg.SessionStore.Replication.Token,
+		})
 	}
 
-	backendManager := balancer.NewBackendManager(serviceRegistryClient, cfg.HealthCheckInterval, cfg.HealthCheckTimeout)
-	go backendManager.StartBackendDiscovery(context.Background())
-	go backendManager.StartHealthChecks(context.Background())
-
-	var lbStrategy balancer.LoadBalancingStrategy
-	switch cfg.Strategy {
-	case "round_robin":
-		lbStrategy = balancer.NewRoundRobinStrategy(backendManager)
-	case "least_connections":
-		lbStrategy = balancer.NewLeastConnectionsStrategy(backendManager)
-	case "sticky_sessions":
-		lbStrategy = balancer.NewStickySessionsStrategy(backendManager)
-	default:
-		log.Fatalf("Unsupported load balancing strategy: %s", cfg.Strategy)
+	reloader, err := app.NewReloader("config.yaml", cfg, store)
+	if err != nil {
+		log.Fatalf("Failed to initialize load balancer: %v", err)
 	}
 
-	reverseProxy := proxy.NewReverseProxyHandler(lbStrategy)
-
+	handler := metrics.PrometheusMiddleware(reloader)
 	server := &http.Server{
 		Addr:    fmt.Sprintf(":%d", cfg.Port),
-		Handler: metrics.PrometheusMiddleware(reverseProxy),
+		Handler: handler,
+	}
+	if cfg.TLS.RedirectHTTP {
+		server.Handler = tlsutil.RedirectHandler(cfg.TLS.Port)
+	}
+
+	// SIGHUP re-reads config.yaml; in-flight requests finish on the settings they started with
+	reloadChan := make(chan os.Signal, 1)
+	signal.Notify(reloadChan, syscall.SIGHUP)
+	go func() {
+		for range reloadChan {
+			log.Println("Received SIGHUP, reloading configuration...")
+			if err := reloader.Reload(); err != nil {
+				log.Printf("Config reload failed: %v", err)
+			}
+		}
+	}()
+
+	watchInterval, err := config.ParseOptionalDuration(cfg.ConfigWatchInterval)
+	if err != nil {
+		log.Fatalf("Invalid config watch interval: %v", err)
+	}
+	watchCtx, stopWatching := context.WithCancel(context.Background())
+	defer stopWatching()
+	if watchInterval > 0 {
+		go reloader.WatchConfigFile(watchCtx, watchInterval)
+	}
+
+	// already validated with the rest of the config
+	trustedProxies, _ := netutil.ParseCIDRs(cfg.ProxyProtocol.TrustedCIDRs)
+
+	var tlsServer *http.Server
+	if cfg.TLS.Port != 0 {
+		tlsServer = newTLSServer(watchCtx, cfg.TLS, handler)
+		tlsListener, err := listen(tlsServer.Addr, trustedProxies)
+		if err != nil {
+			log.Fatalf("HTTPS server error: %v", err)
+		}
+		go func() {
+			log.Printf("HTTPS listener starting on %s with %d certificate(s)", tlsServer.Addr, len(cfg.TLS.Certificates))
+			if err := tlsServer.ServeTLS(tlsListener, "", ""); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("HTTPS server error: %v", err)
+			}
+		}()
 	}
 
 	stopChan := make(chan os.Signal, 1)
 	signal.Notify(stopChan, syscall.SIGINT, syscall.SIGTERM)
 
+	httpListener, err := listen(server.Addr, trustedProxies)
+	if err != nil {
+		log.Fatalf("HTTP server error: %v", err)
+	}
 	go func() {
-		log.Printf("Load balancer starting on :%d with strategy :%s", cfg.Port, cfg.Strategy)
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Printf("Load balancer starting on :%d with %d service(s) and %d route(s)", cfg.Port, len(cfg.Services), len(cfg.Routes))
+		if err := server.Serve(httpListener); err != nil && err != http.ErrServerClosed {
 			log.Fatalf("HTTP server error: %v", err)
 		}
 	}()
 
+	var adminServer *http.Server
+	if cfg.Admin.Port != 0 {
+		adminServer = &http.Server{
+			Addr:    net.JoinHostPort(cfg.Admin.Host, strconv.Itoa(cfg.Admin.Port)),
+			Handler: admin.NewHandler(reloader),
+		}
+		go func() {
+			log.Printf("Admin API starting on %s", adminServer.Addr)
+			if err := adminServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("Admin server error: %v", err)
+			}
+		}()
+	}
+
+	// peers exchange sessions on a listener of their own, the unauthenticated admin API stays where it is
+	var replicationServer *http.Server
+	if replicator != nil {
+		replicationServer = &http.Server{
+			Addr:    net.JoinHostPort(cfg.SessionStore.Replication.Host, strconv.Itoa(cfg.SessionStore.Replication.Port)),
+			Handler: replicator.Handler(),
+		}
+		go func() {
+			log.Printf("Session replication listener starting on %s", replicationServer.Addr)
+			if err := replicationServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("Session replication server error: %v", err)
+			}
+		}()
+		log.Printf("Replicating sticky sessions with %d peer(s)", len(cfg.SessionStore.Replication.Peers))
+		go replicator.Start(watchCtx)
+	}
+
+	// layer 4 listeners pick from the current runtime's pools, so reloaded backends and strategies apply to new connections
+	resolve := func(service string) balancer.LoadBalancingStrategy {
+		if svc := reloader.Current().Service(service); svc != nil {
+			return svc.Strategy
+		}
+		return nil
+	}
+	tcpListeners := newTCPListeners(cfg.TCPListeners, resolve, trustedProxies)
+	for _, listener := range tcpListeners {
+		listener := listener
+		go func() {
+			log.Printf("TCP listener starting on %s", listener.Addr())
+			if err := listener.ListenAndServe(); err != nil {
+				log.Fatalf("TCP listener error: %v", err)
+			}
+		}()
+	}
+	udpListeners := newUDPListeners(cfg.UDPListeners, resolve)
+	for _, listener := range udpListeners {
+		listener := listener
+		go func() {
+			log.Printf("UDP listener starting on %s", listener.Addr())
+			if err := listener.ListenAndServe(); err != nil {
+				log.Fatalf("UDP listener error: %v", err)
+			}
+		}()
+	}
+
 	<- stopChan
 	log.Println("Shutting down load balancer gracefully...")
 
@@ -75,8 +182,129 @@ func main() {
 	if err := server.Shutdown(shutdownCtx); err != nil {
 		log.Fatalf("Server shutdown failed: %v", err)
 	}
+	if tlsServer != nil {
+		if err := tlsServer.Shutdown(shutdownCtx); err != nil {
+			log.Printf("HTTPS server shutdown failed: %v", err)
+		}
+	}
+	if adminServer != nil {
+		if err := adminServer.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Admin server shutdown failed: %v", err)
+		}
+	}
+	if replicationServer != nil {
+		if err := replicationServer.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Session replication server shutdown failed: %v", err)
+		}
+	}
 
-	backendManager.Stop()
+	for _, listener := range tcpListeners {
+		if err := listener.Shutdown(shutdownCtx); err != nil {
+			log.Printf("TCP listener shutdown: %v", err)
+		}
+	}
+	for _, listener := range udpListeners {
+		if err := listener.Shutdown(shutdownCtx); err != nil {
+			log.Printf("UDP listener shutdown: %v", err)
+		}
+	}
+
+	reloader.Stop()
+
+	if store != nil {
+		if err := store.Close(); err != nil {
+			log.Printf("Session store close failed: %v", err)
+		}
+	}
 
 	log.Println("Load balancer shut down")
 }
+
+// certificates are watched for changes until ctx is cancelled
+func newTLSServer(ctx context.Context, tlsCfg config.TLSConfig, handler http.Handler) *http.Server {
+	pairs := make([]tlsutil.KeyPair, 0, len(tlsCfg.Certificates))
+	for _, cert := range tlsCfg.Certificates {
+		pairs = append(pairs, tlsutil.KeyPair{CertFile: cert.CertFile, KeyFile: cert.KeyFile})
+	}
+	certStore, err := tlsutil.NewCertStore(pairs)
+	if err != nil {
+		log.Fatalf("Failed to load TLS certificates: %v", err)
+	}
+
+	// already validated with the rest of the config
+	minVersion, _ := tlsutil.ParseVersion(tlsCfg.MinVersion)
+	cipherSuites, _ := tlsutil.ParseCipherSuites(tlsCfg.CipherSuites)
+
+	reloadInterval, _ := config.ParseOptionalDuration(tlsCfg.CertReloadInterval)
+	if reloadInterval <= 0 {
+		reloadInterval = tlsutil.DefaultCertReloadInterval
+	}
+	go certStore.Watch(ctx, reloadInterval)
+
+	return &http.Server{
+		Addr:      fmt.Sprintf(":%d", tlsCfg.Port),
+		Handler:   handler,
+		TLSConfig: tlsutil.NewServerConfig(certStore, minVersion, cipherSuites),
+	}
+}
+
+// nil when sticky sessions keep their backend in the cookie
+func newSessionStore(storeCfg config.SessionStoreConfig) (sessionstore.Store, error) {
+	switch storeCfg.Type {
+	case "memory":
+		log.Println("Sticky sessions stored in memory")
+		return sessionstore.NewMemoryStore(storeCfg.MaxEntries), nil
+	case "file":
+		log.Printf("Sticky sessions stored in %s", storeCfg.Path)
+		return sessionstore.NewFileStore(storeCfg.Path, storeCfg.MaxEntries)
+	}
+	return nil, nil
+}
+
+// connections from trusted proxies have their PROXY protocol header parsed
+func listen(addr string, trustedProxies []*net.IPNet) (net.Listener, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if len(trustedProxies) > 0 {
+		return proxyproto.NewListener(listener, trustedProxies), nil
+	}
+	return listener, nil
+}
+
+func newTCPListeners(listenerCfgs []config.TCPListenerConfig, resolve balancer.StrategyResolver, trustedProxies []*net.IPNet) []*tcpproxy.Listener {
+	listeners := make([]*tcpproxy.Listener, 0, len(listenerCfgs))
+	for _, listenerCfg := range listenerCfgs {
+		// already validated with the rest of the config
+		connectTimeout, _ := config.ParseOptionalDuration(listenerCfg.ConnectTimeout)
+		idleTimeout, _ := config.ParseOptionalDuration(listenerCfg.IdleTimeout)
+		sendProxyProtocol, _ := proxyproto.ParseVersion(listenerCfg.SendProxyProtocol)
+		listeners = append(listeners, tcpproxy.NewListener(tcpproxy.Options{
+			Name:              listenerCfg.Name,
+			Address:           fmt.Sprintf(":%d", listenerCfg.Port),
+			Service:           listenerCfg.Service,
+			ConnectTimeout:    connectTimeout,
+			IdleTimeout:       idleTimeout,
+			TrustedProxies:    trustedProxies,
+			SendProxyProtocol: sendProxyProtocol,
+		}, resolve))
+	}
+	return listeners
+}
+
+func newUDPListeners(listenerCfgs []config.UDPListenerConfig, resolve balancer.StrategyResolver) []*udpproxy.Listener {
+	listeners := make([]*udpproxy.Listener, 0, len(listenerCfgs))
+	for _, listenerCfg := range listenerCfgs {
+		// already validated with the rest of the config
+		sessionTimeout, _ := config.ParseOptionalDuration(listenerCfg.SessionTimeout)
+		listeners = append(listeners, udpproxy.NewListener(udpproxy.Options{
+			Name:           listenerCfg.Name,
+			Address:        fmt.Sprintf(":%d", listenerCfg.Port),
+			Service:        listenerCfg.Service,
+			SessionTimeout: sessionTimeout,
+			MaxSessions:    listenerCfg.MaxSessions,
+		}, resolve))
+	}
+	return listeners
+}
@@ -1,15 +1,20 @@
 package com.example.serviceregistry.controller;
 
+import com.example.serviceregistry.model.ServiceChangeEvent;
 import com.example.serviceregistry.model.ServiceInstance;
 import com.example.serviceregistry.service.ServiceRegistryService;
 import lombok.extern.slf4j.Slf4j;
 import org.springframework.http.HttpStatus;
+import org.springframework.http.MediaType;
 import org.springframework.http.ResponseEntity;
 import org.springframework.web.bind.annotation.*;
+import org.springframework.web.servlet.mvc.method.annotation.SseEmitter;
 
+import java.io.IOException;
 import java.security.Provider.Service;
 import java.util.Collection;
 import java.util.List;
+import java.util.function.Consumer;
 import java.util.stream.Collectors;
 import org.springframework.web.bind.annotation.GetMapping;
 import org.springframework.web.bind.annotation.RequestParam;
@@ -34,6 +39,9 @@ public class ServiceRegistryRestController {
         instance.getHealthPath() == null || instance.getHealthPath().isEmpty()) {
             return new ResponseEntity<>(HttpStatus.BAD_REQUEST);
         }
+        if (instance.getWeight() < 0) {
+            return new ResponseEntity<>(HttpStatus.BAD_REQUEST);
+        }
         ServiceInstance registered = serviceRegistryService.registerService(instance);
         return new ResponseEntity<>(registered, HttpStatus.CREATED);
     }
@@ -56,8 +64,55 @@ public class ServiceRegistryRestController {
     @GetMapping
     public ResponseEntity<List<ServiceInstance>> getHealthyServices() {
         List<ServiceInstance> lightWeightInstances = serviceRegistryService.getHealthyServices().stream()
-                .map(instance -> new ServiceInstance(instance.getId(), instance.getServiceName(), instance.getHost(), instance.getPort(), instance.getUrl(), instance.getHealthPath(), null, false))
+                .map(this::toLightWeightInstance)
                 .collect(Collectors.toList());
         return ResponseEntity.ok(lightWeightInstances);
-    }   
+    }
+
+    // server-sent events: every healthy instance as "added", then "synced", then changes as they happen
+    @GetMapping(path = "/watch", produces = MediaType.TEXT_EVENT_STREAM_VALUE)
+    public SseEmitter watchServices() {
+        SseEmitter emitter = new SseEmitter(0L); // never times out
+        // emitters are not thread-safe, and changes may be published from several threads
+        Object lock = new Object();
+
+        Consumer<ServiceChangeEvent> listener = event -> {
+            synchronized (lock) {
+                try {
+                    emitter.send(SseEmitter.event()
+                            .name(event.getType().name().toLowerCase())
+                            .data(toLightWeightInstance(event.getInstance()), MediaType.APPLICATION_JSON));
+                }
+                catch (IOException e) {
+                    emitter.completeWithError(e);
+                }
+            }
+        };
+        Runnable cleanup = () -> serviceRegistryService.removeListener(listener);
+        emitter.onCompletion(cleanup);
+        emitter.onTimeout(cleanup);
+        emitter.onError(e -> cleanup.run());
+
+        // listening before taking the snapshot so no change is missed; duplicates are treated as updates by watchers
+        synchronized (lock) {
+            serviceRegistryService.addListener(listener);
+            try {
+                for (ServiceInstance instance : serviceRegistryService.getHealthyServices()) {
+                    emitter.send(SseEmitter.event()
+                            .name("added")
+                            .data(toLightWeightInstance(instance), MediaType.APPLICATION_JSON));
+                }
+                emitter.send(SseEmitter.event().name("synced").data("{}"));
+            }
+            catch (IOException e) {
+                emitter.completeWithError(e);
+            }
+        }
+        log.info("Opened service watch stream");
+        return emitter;
+    }
+
+    private ServiceInstance toLightWeightInstance(ServiceInstance instance) {
+        return new ServiceInstance(instance.getId(), instance.getServiceName(), instance.getHost(), instance.getPort(), instance.getUrl(), instance.getHealthPath(), instance.getWeight(), instance.getMetadata(), null, false);
+    }
 }
\ No newline at end of file
@@ -1,14 +1,18 @@
 package com.example.serviceregistry.grpc;
 
 import com.example.serviceregistry.ServiceRegistryApplication;
+import com.example.serviceregistry.model.ServiceChangeEvent;
 import com.example.serviceregistry.model.ServiceInstance;
 import com.example.serviceregistry.service.ServiceRegistryService;
+import io.grpc.stub.ServerCallStreamObserver;
 import io.grpc.stub.StreamObserver;
 import lombok.extern.slf4j.Slf4j;
 import net.devh.boot.grpc.server.service.GrpcService;
 
 import java.util.Collection;
 import java.util.List;
+import java.util.Map;
+import java.util.function.Consumer;
 import java.util.stream.Collectors;
 
 @GrpcService
@@ -25,14 +29,7 @@ public class ServiceRegistryGrpcService extends ServiceRegistryGrpc.ServiceRegis
         log.info("Received gRPC request for healthy services");
         Collection<ServiceInstance> healthyServices = serviceRegistryService.getHealthyServices();
         List<GrpcServiceInstance> grpcInstances = healthyServices.stream()
-                .map(instance -> GrpcServiceInstance.newBuilder()
-                            .setId(instance.getId())
-                            .setServiceName(instance.getServiceName())
-                            .setHost(instance.getHost())
-                            .setPort(instance.getPort())
-                            .setUrl(instance.getUrl())
-                            .setHealthPath(instance.getHealthPath())
-                            .build())
+                .map(this::toGrpcInstance)
                 .collect(Collectors.toList());
         GetHealthyServicesResponse response = GetHealthyServicesResponse.newBuilder()
                 .addAllServices(grpcInstances)
@@ -42,6 +39,41 @@ public class ServiceRegistryGrpcService extends ServiceRegistryGrpc.ServiceRegis
         responseObserver.onCompleted();
     }
 
+    @Override
+    public void watchServices(WatchServicesRequest request, StreamObserver<ServiceEvent> responseObserver) {
+        log.info("Received gRPC request to watch services");
+        ServerCallStreamObserver<ServiceEvent> serverObserver = (ServerCallStreamObserver<ServiceEvent>) responseObserver;
+        // stream observers are not thread-safe, and changes may be published from several threads
+        Object lock = new Object();
+
+        Consumer<ServiceChangeEvent> listener = event -> {
+            synchronized (lock) {
+                serverObserver.onNext(ServiceEvent.newBuilder()
+                        .setType(ServiceEvent.Type.valueOf(event.getType().name()))
+                        .setInstance(toGrpcInstance(event.getInstance()))
+                        .build());
+            }
+        };
+        serverObserver.setOnCancelHandler(() -> {
+            serviceRegistryService.removeListener(listener);
+            log.info("gRPC watch of services cancelled");
+        });
+
+        // listening before taking the snapshot so no change is missed; duplicates are treated as updates by watchers
+        synchronized (lock) {
+            serviceRegistryService.addListener(listener);
+            for (ServiceInstance instance : serviceRegistryService.getHealthyServices()) {
+                serverObserver.onNext(ServiceEvent.newBuilder()
+                        .setType(ServiceEvent.Type.ADDED)
+                        .setInstance(toGrpcInstance(instance))
+                        .build());
+            }
+            serverObserver.onNext(ServiceEvent.newBuilder()
+                    .setType(ServiceEvent.Type.SYNCED)
+                    .build());
+        }
+    }
+
     @Override
     public void registerService(RegisterServiceRequest request, StreamObserver<ServiceRegistryResponse> responseObserver) {
         GrpcServiceInstance grpcInstance = request.getInstance();
@@ -52,6 +84,8 @@ public class ServiceRegistryGrpcService extends ServiceRegistryGrpc.ServiceRegis
                 grpcInstance.getPort(),
                 grpcInstance.getUrl(),
                 grpcInstance.getHealthPath(),
+                grpcInstance.getWeight(),
+                grpcInstance.getMetadataMap(),
                 null,
                 true
         );
@@ -119,4 +153,17 @@ public class ServiceRegistryGrpcService extends ServiceRegistryGrpc.ServiceRegis
             responseObserver.onError(e);
         }
     }
+
+    private GrpcServiceInstance toGrpcInstance(ServiceInstance instance) {
+        return GrpcServiceInstance.newBuilder()
+                .setId(instance.getId())
+                .setServiceName(instance.getServiceName())
+                .setHost(instance.getHost())
+                .setPort(instance.getPort())
+                .setUrl(instance.getUrl())
+                .setHealthPath(instance.getHealthPath())
+                .setWeight(instance.getWeight())
+                .putAllMetadata(instance.getMetadata() == null ? Map.of() : instance.getMetadata())
+                .build();
+    }
 }
@@ -0,0 +1,18 @@
+package com.example.serviceregistry.model;
+
+import lombok.AllArgsConstructor;
+import lombok.Data;
+
+// change to the set of healthy service instances, pushed to watchers
+@Data
+@AllArgsConstructor
+public class ServiceChangeEvent {
+    public enum Type {
+        ADDED,
+        UPDATED,
+        REMOVED
+    }
+
+    private Type type;
+    private ServiceInstance instance;
+}
@@ -5,6 +5,7 @@ import lombok.Data;
 import lombok.NoArgsConstructor;
 
 import java.time.LocalDateTime;
+import java.util.Map;
 
 @Data
 @AllArgsConstructor
@@ -16,6 +17,8 @@ public class ServiceInstance {
     private int port;
     private String url;
     private String healthPath;
+    private int weight; // 0 when the instance does not report one
+    private Map<String, String> metadata; // free-form details passed on to the load balancer, e.g. healthCheckType
     private LocalDateTime lastHeartbeat;
     private boolean alive;
 }
@@ -1,5 +1,6 @@
 package com.example.serviceregistry.service;
 
+import com.example.serviceregistry.model.ServiceChangeEvent;
 import com.example.serviceregistry.model.ServiceInstance;
 import io.micrometer.core.instrument.Gauge;
 import io.micrometer.core.instrument.MeterRegistry;
@@ -10,16 +11,21 @@ import org.springframework.stereotype.Service;
 import javax.annotation.PostConstruct;
 import java.time.LocalDateTime;
 import java.util.Collection;
+import java.util.List;
 import java.util.Map;
 import java.util.Optional;
 import java.util.concurrent.ConcurrentHashMap;
+import java.util.concurrent.CopyOnWriteArrayList;
 import java.util.concurrent.atomic.AtomicInteger;
+import java.util.function.Consumer;
 import java.util.stream.Collectors;
 
 @Service
 @Slf4j // logger
 public class ServiceRegistryService {
     private final Map<String, ServiceInstance> registeredServices = new ConcurrentHashMap<>();
+    // watchers notified of every change to the set of healthy services
+    private final List<Consumer<ServiceChangeEvent>> listeners = new CopyOnWriteArrayList<>();
 
     @Value("${service.heartbeat.timeout.seconds:10}")
     private long heartbeatTimeoutSeconds;
@@ -41,9 +47,10 @@ public class ServiceRegistryService {
     public ServiceInstance registerService(ServiceInstance instance) {
         instance.setLastHeartbeat(LocalDateTime.now());
         instance.setAlive(true);
-        registeredServices.put(instance.getId(), instance);
+        ServiceInstance previous = registeredServices.put(instance.getId(), instance);
         registeredServicesCount.set(registeredServices.size());
         log.info("Service registered/updated: {} (ID: {})", instance.getServiceName(), instance.getId());
+        publish(previous != null && previous.isAlive() ? ServiceChangeEvent.Type.UPDATED : ServiceChangeEvent.Type.ADDED, instance);
 
         // registering a gauge for each service's heartbeat status
         Gauge.builder("service_registry_instance_alive", instance, si -> si.isAlive() ? 1.0 : 0.0)
@@ -62,6 +69,9 @@ public class ServiceRegistryService {
         if (removed != null) {
             log.info("Service deregistered: {} (ID: {})", removed.getServiceName(), removed.getId());
             registeredServicesCount.set(registeredServices.size());
+            if (removed.isAlive()) {
+                publish(ServiceChangeEvent.Type.REMOVED, removed);
+            }
             
             // GC automatically handles cleanup and removes gauge of the removed service
 
@@ -83,6 +93,7 @@ public class ServiceRegistryService {
                 // automatically updates gauge value to 1
                 instance.setAlive(true);
                 log.info("Service {} (ID: {}) is now healthy via heartbeat", instance.getServiceName(), instance.getId());
+                publish(ServiceChangeEvent.Type.ADDED, instance);
 
                 // manual updation
                 // meterRegistry.get("service_registry_instance_alive").tag("instance_id", instanceId).tag("service_name", instance.getServiceName()).gauge().set(1.0);
@@ -102,12 +113,14 @@ public class ServiceRegistryService {
                     if (!isHealthy & instance.isAlive()) {
                         instance.setAlive(false);
                         log.warn("Service: {} (ID: {}) marked unhealthy due to an expired heartbeat", instance.getServiceName(), instance.getId());
+                        publish(ServiceChangeEvent.Type.REMOVED, instance);
                         // manual updation
                         //meterRegistry.get("service_registry_instance_alive").tag("instance_id", instance.getId()).tag("service_name", instance.getServiceName()).gauge().set(1.0);
                     }
                     else if (isHealthy && !instance.isAlive()) {
                         instance.setAlive(true);
                         log.info("Service {} (ID: {}) is now healthy (due to fresh heartbeat).", instance.getServiceName(), instance.getId());
+                        publish(ServiceChangeEvent.Type.ADDED, instance);
                         // manual updation
                         // meterRegistry.get("service_registry_instance_alive").tag("instance_id", instance.getId()).tag("service_name", instance.getServiceName()).gauge().set(1.0);
                     }
@@ -120,4 +133,24 @@ public class ServiceRegistryService {
     public Optional<ServiceInstance> getServiceInstance(String instanceId) {
         return Optional.ofNullable(registeredServices.get(instanceId));
     }
+
+    public void addListener(Consumer<ServiceChangeEvent> listener) {
+        listeners.add(listener);
+    }
+
+    public void removeListener(Consumer<ServiceChangeEvent> listener) {
+        listeners.remove(listener);
+    }
+
+    private void publish(ServiceChangeEvent.Type type, ServiceInstance instance) {
+        ServiceChangeEvent event = new ServiceChangeEvent(type, instance);
+        for (Consumer<ServiceChangeEvent> listener : listeners) {
+            try {
+                listener.accept(event);
+            }
+            catch (Exception e) {
+                log.warn("Failed to notify watcher of {} event for service {} (ID: {}): {}", type, instance.getServiceName(), instance.getId(), e.getMessage());
+            }
+        }
+    }
 }
\ No newline at end of file